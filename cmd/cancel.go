@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"zeng_bot/internal/history"
+	"zeng_bot/internal/models"
+	"zeng_bot/internal/session"
+	"zeng_bot/internal/task"
+)
+
+// cancelCommand asks Target to cancel an order from the history ledger
+// with the account that placed it, and records the outcome in the ledger.
+// The profile's saved session is reused when there is one, so the usual
+// case needs no browser login.
+func cancelCommand(args []string) int {
+	fs := newFlagSet("cancel")
+	cf := addConfigFlags(fs)
+	useReal := fs.Bool("real", os.Getenv("USE_REAL_CLIENT") == "1",
+		"use the production TargetClient (default: NoOpClient, or $USE_REAL_CLIENT=1)")
+	historyPath := fs.String("history", "orders.jsonl", "order history ledger to find the order in and record the outcome")
+	sessionsDir := fs.String("sessions", "sessions", "directory of saved sessions to reuse and update")
+	orderID := fs.String("order", "", "ID of the order to cancel (required)")
+	reason := fs.String("reason", "CHANGED_MIND", "cancel reason code sent to Target")
+	timeout := fs.Duration("timeout", 3*time.Minute, "give up if logging in and cancelling take longer than this")
+	if code := parseFlags(fs, args); code >= 0 {
+		return code
+	}
+	if *orderID == "" {
+		log.Printf("[cancel] --order is required")
+		return exitUsage
+	}
+
+	cfg, err := cf.load()
+	if err != nil {
+		log.Printf("[cancel] %v", err)
+		return exitInvalidConfig
+	}
+
+	ledger := history.NewLedger(*historyPath)
+	rec, err := findOrder(ledger, *orderID)
+	if err != nil {
+		log.Printf("[cancel] %v", err)
+		return exitFailure
+	}
+	if rec.Status == models.OrderCancelled {
+		fmt.Printf("order %s is already cancelled\n", rec.OrderID)
+		return exitOK
+	}
+	profile, found := cfg.LookupProfile(rec.Profile)
+	if !found {
+		log.Printf("[cancel] order %s was placed by profile %q, which is not in the config", rec.OrderID, rec.Profile)
+		return exitInvalidConfig
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	ctx, cancel := context.WithTimeout(ctx, *timeout)
+	defer cancel()
+
+	var client task.OrderCanceller = &task.NoOpClient{}
+	if *useReal {
+		saved, err := openSavedSession(ctx, session.NewStore(*sessionsDir), profile)
+		if err != nil {
+			log.Printf("[cancel] %v", err)
+			return exitLoginFailed
+		}
+		defer saved.Save()
+		client = saved
+	}
+
+	c := history.Cancellation{RequestedAt: time.Now(), Reason: *reason}
+	status, err := client.CancelOrder(ctx, rec.OrderID, *reason)
+	switch {
+	case err == nil && status == models.OrderCancelled:
+		c.Outcome = history.CancelConfirmed
+	case err == nil:
+		c.Outcome = history.CancelRequested
+	case errors.Is(err, task.ErrNotCancellable):
+		c.Outcome, c.Error = history.CancelRejected, err.Error()
+	default:
+		c.Outcome, c.Error = history.CancelFailed, err.Error()
+	}
+
+	updateErr := ledger.Update(rec.OrderID, func(r *history.Record) {
+		r.Cancellation = &c
+		if status != "" {
+			r.SetStatus(status, time.Now())
+		}
+	})
+	if updateErr != nil {
+		log.Printf("[cancel] failed to record cancellation of order %s: %v", rec.OrderID, updateErr)
+	}
+
+	switch c.Outcome {
+	case history.CancelConfirmed:
+		fmt.Printf("order %s cancelled\n", rec.OrderID)
+	case history.CancelRequested:
+		fmt.Printf("order %s: cancellation requested, Target has not confirmed it yet (see the track command)\n", rec.OrderID)
+	default:
+		fmt.Printf("order %s not cancelled: %v\n", rec.OrderID, err)
+	}
+	switch {
+	case ctx.Err() != nil && err != nil:
+		return exitInterrupted
+	case errors.Is(err, task.ErrSessionExpired):
+		return exitLoginFailed
+	case err != nil || updateErr != nil:
+		return exitFailure
+	default:
+		return exitOK
+	}
+}
+
+// findOrder returns the ledger's record for orderID.
+func findOrder(ledger *history.Ledger, orderID string) (history.Record, error) {
+	records, err := ledger.List()
+	if err != nil {
+		return history.Record{}, err
+	}
+	for _, r := range records {
+		if r.OrderID == orderID {
+			return r, nil
+		}
+	}
+	return history.Record{}, fmt.Errorf("order %s is not in %s: %w", orderID, ledger.Path(), history.ErrNotFound)
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"slices"
+
+	"zeng_bot/internal/config"
+	"zeng_bot/internal/models"
+	"zeng_bot/internal/orchestrator"
+	"zeng_bot/internal/vault"
+)
+
+// debugUnredactedFlag disables log redaction. Every subcommand accepts it.
+const debugUnredactedFlag = "debug-unredacted"
+
+// newFlagSet returns a FlagSet for the named subcommand that reports
+// parse errors instead of exiting.
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Bool(debugUnredactedFlag, false, "log full request and response bodies, including card data and tokens (local debugging only)")
+	return fs
+}
+
+// parseFlags parses args into fs and returns the exit code to use if
+// parsing stopped the command (-h or a bad flag), or -1 to continue.
+func parseFlags(fs *flag.FlagSet, args []string) int {
+	err := fs.Parse(args)
+	switch {
+	case err == nil:
+	case errors.Is(err, flag.ErrHelp):
+		return exitOK
+	default:
+		return exitUsage
+	}
+
+	if f := fs.Lookup(debugUnredactedFlag); f != nil && f.Value.String() == "true" {
+		logOutput.SetEnabled(false)
+		log.Printf("[main] WARNING: log redaction disabled by --%s; logs will contain card data and credentials", debugUnredactedFlag)
+	}
+	return -1
+}
+
+// configFlags are the flags every config-consuming command accepts.
+type configFlags struct {
+	path        string
+	productsCSV string
+	profilesCSV string
+	profileName string
+	vaultPath   string
+}
+
+func addConfigFlags(fs *flag.FlagSet) *configFlags {
+	c := &configFlags{}
+	fs.StringVar(&c.path, "config", "config.json", "path to a JSON or YAML config file")
+	fs.StringVar(&c.productsCSV, "products-csv", "", "load products from a CSV watchlist instead of the config file")
+	fs.StringVar(&c.profilesCSV, "profiles-csv", "", "load profiles from a CSV file instead of the config file")
+	fs.StringVar(&c.profileName, "profile", "", "name of the default profile, used by tasks that name none (default: first)")
+	fs.StringVar(&c.vaultPath, "vault", "", "load profiles from this encrypted vault (passphrase from $"+passphraseEnv+" or stdin)")
+	return c
+}
+
+// load parses the config file, applies any CSV overrides and validates
+// the result. Validation runs before any session is created so that
+// typos and expired cards fail fast instead of mid-drop.
+func (c *configFlags) load() (orchestrator.Config, error) {
+	cfg, err := config.Parse(c.path)
+	if err != nil {
+		return cfg, err
+	}
+
+	if c.productsCSV != "" {
+		cfg.Products, err = readCSVFile(c.productsCSV, config.ReadProducts)
+		if err != nil {
+			return cfg, fmt.Errorf("%s: %w", c.productsCSV, err)
+		}
+	}
+	if c.profilesCSV != "" && c.vaultPath != "" {
+		return cfg, fmt.Errorf("--profiles-csv and --vault are mutually exclusive")
+	}
+	source := c.path
+	switch {
+	case c.profilesCSV != "":
+		source = c.profilesCSV
+		cfg.Profiles, err = readCSVFile(c.profilesCSV, config.ReadProfiles)
+		if err != nil {
+			return cfg, fmt.Errorf("%s: %w", c.profilesCSV, err)
+		}
+	case c.vaultPath != "":
+		if hasCleartextCard(cfg) {
+			log.Printf("[config] warning: %s holds cleartext card data that the vault profiles will override", c.path)
+		}
+		source = c.vaultPath
+		cfg.Profiles, err = loadVaultProfiles(c.vaultPath)
+		if err != nil {
+			return cfg, fmt.Errorf("%s: %w", c.vaultPath, err)
+		}
+	}
+	if c.profileName != "" {
+		cfg.Profiles, err = selectProfile(cfg.Profiles, c.profileName)
+		if err != nil {
+			return cfg, fmt.Errorf("%s: %w", source, err)
+		}
+	}
+
+	if err := config.Validate(cfg); err != nil {
+		return cfg, err
+	}
+	return cfg, nil
+}
+
+// hasCleartextCard reports whether any profile in cfg carries a card
+// number.
+func hasCleartextCard(cfg orchestrator.Config) bool {
+	return slices.ContainsFunc(cfg.Profiles, func(p models.Profile) bool {
+		return p.Payment.CardNumber != "" || len(p.GiftCards) > 0
+	})
+}
+
+// loadVaultProfiles decrypts the vault in memory and returns its profiles.
+func loadVaultProfiles(path string) ([]models.Profile, error) {
+	passphrase, err := readPassphrase("Vault passphrase: ")
+	if err != nil {
+		return nil, err
+	}
+	v, err := vault.Open(path, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	return v.Profiles(), nil
+}
+
+// readCSVFile opens path and decodes it with read.
+func readCSVFile[T any](path string, read func(io.Reader) ([]T, error)) ([]T, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return read(f)
+}
+
+// selectProfile makes the profile called name the default by moving it to
+// the front. The others stay available to tasks that name them.
+func selectProfile(profiles []models.Profile, name string) ([]models.Profile, error) {
+	idx := slices.IndexFunc(profiles, func(p models.Profile) bool { return p.Name == name })
+	if idx < 0 {
+		return nil, fmt.Errorf("profile %q not found", name)
+	}
+	out := append([]models.Profile{profiles[idx]}, profiles[:idx]...)
+	return append(out, profiles[idx+1:]...), nil
+}
+
+// writeCSVFile creates path with owner-only permissions, since profile
+// exports contain credentials and card data.
+func writeCSVFile(path string, write func(io.Writer) error) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"zeng_bot/internal/history"
+	"zeng_bot/internal/models"
+)
+
+// historyCommand lists orders from the ledger written by run.
+func historyCommand(args []string) int {
+	fs := newFlagSet("history")
+	historyPath := fs.String("history", "orders.jsonl", "order history ledger to read")
+	profile := fs.String("profile", "", "only show orders placed by this profile")
+	tcin := fs.String("tcin", "", "only show orders for this TCIN")
+	taskID := fs.String("task", "", "only show orders placed by this task ID")
+	asJSON := fs.Bool("json", false, "print records as JSON lines instead of a table")
+	if code := parseFlags(fs, args); code >= 0 {
+		return code
+	}
+
+	records, err := history.NewLedger(*historyPath).List()
+	if err != nil {
+		log.Printf("[history] %v", err)
+		return exitFailure
+	}
+
+	var filtered []history.Record
+	for _, r := range records {
+		if *profile != "" && r.Profile != *profile {
+			continue
+		}
+		if *tcin != "" && r.TCIN != *tcin {
+			continue
+		}
+		if *taskID != "" && r.TaskID != *taskID {
+			continue
+		}
+		filtered = append(filtered, r)
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		for _, r := range filtered {
+			if err := enc.Encode(r); err != nil {
+				log.Printf("[history] %v", err)
+				return exitFailure
+			}
+		}
+		return exitOK
+	}
+
+	if len(filtered) == 0 {
+		fmt.Println("no orders found")
+		return exitOK
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TIME\tORDER\tTASK\tPROFILE\tTCIN\tQTY\tTOTAL\tPAID WITH\tSTATUS\tNAME")
+	for _, r := range filtered {
+		total := "-"
+		if r.Total > 0 {
+			total = r.Total.String()
+		}
+		paid := "-"
+		if len(r.Tenders) > 0 {
+			paid = models.FormatTenders(r.Tenders)
+		}
+		order := r.OrderID
+		if order == "" {
+			order = "unknown"
+		}
+		status := "-"
+		if r.Status != "" {
+			status = string(r.Status)
+		}
+		if c := r.Cancellation; c != nil && r.Status != models.OrderCancelled {
+			status += fmt.Sprintf(" (cancel %s)", c.Outcome)
+		}
+		// Records from before quantities were tracked are single units.
+		qty := max(r.Quantity, 1)
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%d\t%s\t%s\t%s\t%s\n",
+			r.Time.Local().Format(time.DateTime), order, r.TaskID, r.Profile, r.TCIN, qty, total, paid, status, r.Name)
+	}
+	if err := tw.Flush(); err != nil {
+		log.Printf("[history] %v", err)
+		return exitFailure
+	}
+	return exitOK
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"zeng_bot/internal/session"
+)
+
+// loginCheckCommand runs WarmUp and Login for the default profile and
+// reports which PerimeterX and auth cookies the session ended up with. A
+// successful login is saved for commands that reuse sessions.
+func loginCheckCommand(args []string) int {
+	fs := newFlagSet("login-check")
+	cf := addConfigFlags(fs)
+	warmUpOnly := fs.Bool("warmup-only", false, "stop after WarmUp without logging in")
+	timeout := fs.Duration("timeout", 2*time.Minute, "give up if warm-up and login take longer than this")
+	sessionsDir := fs.String("sessions", "sessions", "directory to save the logged-in session in (empty: don't save)")
+	if code := parseFlags(fs, args); code >= 0 {
+		return code
+	}
+
+	cfg, err := cf.load()
+	if err != nil {
+		log.Printf("[login-check] %v", err)
+		return exitInvalidConfig
+	}
+
+	sess, err := session.NewTargetSession()
+	if err != nil {
+		log.Printf("[login-check] failed to create session: %v", err)
+		return exitFailure
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	if err := sess.WarmUp(ctx); err != nil {
+		log.Printf("[login-check] warm-up failed: %v", err)
+		return exitLoginFailed
+	}
+	profile, _ := cfg.DefaultProfile()
+	if !*warmUpOnly {
+		if err := sess.Login(ctx, profile.Email, profile.Password); err != nil {
+			log.Printf("[login-check] login failed: %v", err)
+			return exitLoginFailed
+		}
+	}
+
+	auth := sess.AuthCookies()
+	fmt.Printf("visitorId:    %s\n", presence(sess.VisitorID != ""))
+	fmt.Printf("PX cookies:   %s\n", cookieList(sess.GetCookies()))
+	fmt.Printf("auth cookies: %s\n", cookieList(auth))
+
+	if *warmUpOnly {
+		return exitOK
+	}
+	if auth["accessToken"] == "" {
+		fmt.Println("result:       not logged in (no accessToken cookie)")
+		return exitLoginFailed
+	}
+	fmt.Println("result:       logged in")
+	if *sessionsDir != "" {
+		saveSession(session.NewStore(*sessionsDir), profile.Name, sess)
+	}
+	return exitOK
+}
+
+func presence(ok bool) string {
+	if ok {
+		return "present"
+	}
+	return "missing"
+}
+
+// cookieList returns the sorted cookie names, never their values.
+func cookieList(cookies map[string]string) string {
+	if len(cookies) == 0 {
+		return "none"
+	}
+	names := make([]string, 0, len(cookies))
+	for name := range cookies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
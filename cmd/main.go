@@ -2,67 +2,78 @@
 package main
 
 import (
+	"fmt"
 	"log"
 	"os"
 
-	"zeng_bot/internal/models"
-	"zeng_bot/internal/orchestrator"
-	"zeng_bot/internal/session"
-	"zeng_bot/internal/task"
+	"zeng_bot/internal/redact"
 )
 
+// Exit codes shared by every subcommand so scripts can branch on them.
+const (
+	exitOK             = 0
+	exitFailure        = 1 // unexpected runtime error
+	exitUsage          = 2 // bad flags or unknown command
+	exitInvalidConfig  = 3 // config failed to load or validate
+	exitLoginFailed    = 4 // warm-up or login did not produce a session
+	exitCheckoutFailed = 5 // at least one checkout attempt failed
+	exitInterrupted    = 6 // shut down by SIGINT/SIGTERM before finishing
+)
+
+// command is a CLI subcommand. run receives the arguments after the
+// command name and returns the process exit code.
+type command struct {
+	name    string
+	summary string
+	run     func(args []string) int
+}
+
+// logOutput redacts PII, card data and credentials from every log line.
+// It is only disabled by an explicit --debug-unredacted flag.
+var logOutput = redact.NewWriter(os.Stderr)
+
+var commands = []command{
+	{"run", "start the orchestrator and place orders", runCommand},
+	{"dry-run", "go through login and add-to-cart without placing an order", dryRunCommand},
+	{"validate", "check the config and optionally export it as CSV", validateCommand},
+	{"login-check", "warm up and log in, then report cookie state", loginCheckCommand},
+	{"history", "list orders placed by previous runs", historyCommand},
+	{"track", "poll placed orders' status and record changes in the history", trackCommand},
+	{"cancel", "cancel an order from the history with the profile's saved session", cancelCommand},
+	{"vault", "manage the encrypted profile vault (init, add, list, remove)", vaultCommand},
+}
+
 func main() {
-	log.Println("zeng_bot starting...")
+	log.SetOutput(logOutput)
 
-	// Placeholder config — will be replaced with CSV/JSON parsing.
-	cfg := orchestrator.Config{
-		WorkerCount: 3,
-		Profile: models.Profile{
-			Name:     "Test User",
-			Email:    "test",
-			Password: "test",
-		},
-		Products: []models.TargetProduct{
-			{DPCI: "000-00-0000", TCIN: "89828965", StoreID: "1234"},
-		},
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(exitUsage)
 	}
 
-	// Set USE_REAL_CLIENT=1 to use the production TargetClient
-	// backed by real HTTP sessions. Default is NoOp for safe testing.
-	useReal := os.Getenv("USE_REAL_CLIENT") == "1"
-
-	var clientFactory func() task.CheckoutClient
-	if useReal {
-		log.Println("[main] using real TargetClient")
-		clientFactory = func() task.CheckoutClient {
-			sess, err := session.NewTargetSession()
-			if err != nil {
-				log.Fatalf("[main] failed to create session: %v", err)
-			}
-			client, err := task.NewTargetClient(sess, cfg.Profile)
-			if err != nil {
-				log.Fatalf("[main] failed to create target client: %v", err)
-			}
-			return client
-		}
-	} else {
-		log.Println("[main] using NoOpClient (set USE_REAL_CLIENT=1 for real requests)")
-		clientFactory = func() task.CheckoutClient {
-			return &task.NoOpClient{}
+	name := os.Args[1]
+	for _, c := range commands {
+		if c.name == name {
+			os.Exit(c.run(os.Args[2:]))
 		}
 	}
 
-	orch := orchestrator.New(cfg, clientFactory)
-
-	// Simulate a stock event to exercise the pipeline.
-	events := make(chan models.StockEvent, 1)
-	events <- models.StockEvent{
-		Product:    cfg.Products[0],
-		OfferID:    "test-offer",
-		LocationID: "test-location",
+	if name == "help" || name == "-h" || name == "--help" {
+		usage()
+		os.Exit(exitOK)
 	}
-	close(events)
+	fmt.Fprintf(os.Stderr, "unknown command %q\n\n", name)
+	usage()
+	os.Exit(exitUsage)
+}
 
-	orch.Run(events)
-	log.Println("zeng_bot finished.")
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: zeng_bot <command> [flags]")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "commands:")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-12s %s\n", c.name, c.summary)
+	}
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Run 'zeng_bot <command> -h' for command flags.")
 }
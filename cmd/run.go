@@ -0,0 +1,396 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"zeng_bot/internal/history"
+	"zeng_bot/internal/models"
+	"zeng_bot/internal/monitor"
+	"zeng_bot/internal/orchestrator"
+	"zeng_bot/internal/orders"
+	"zeng_bot/internal/session"
+	"zeng_bot/internal/task"
+)
+
+// runCommand starts the orchestrator and records every placed order in
+// the history ledger.
+func runCommand(args []string) int {
+	fs := newFlagSet("run")
+	cf := addConfigFlags(fs)
+	useReal := fs.Bool("real", os.Getenv("USE_REAL_CLIENT") == "1",
+		"use the production TargetClient (default: NoOpClient, or $USE_REAL_CLIENT=1)")
+	historyPath := fs.String("history", "orders.jsonl", "order history ledger to append placed orders to")
+	sessionsDir := fs.String("sessions", "sessions", "directory to save each profile's logged-in session in, for the cancel command")
+	grace := fs.Duration("grace", orchestrator.DefaultGracePeriod, "on SIGINT/SIGTERM, let in-flight checkouts finish for this long")
+	trackFor := fs.Duration("track-for", 0, "after the run, poll each placed order's status for up to this long (0: don't; see the track command)")
+	trackInterval := fs.Duration("track-interval", time.Minute, "time between status polls of one order")
+	sf := addSourceFlags(fs)
+	if code := parseFlags(fs, args); code >= 0 {
+		return code
+	}
+
+	cfg, err := cf.load()
+	if err != nil {
+		log.Printf("[run] %v", err)
+		return exitInvalidConfig
+	}
+
+	ledger := history.NewLedger(*historyPath)
+	track := orders.Options{Interval: *trackInterval, Timeout: *trackFor}
+	return checkout("run", cfg, sf, *useReal, false, *grace, ledger, session.NewStore(*sessionsDir), track)
+}
+
+// dryRunCommand goes through the same flow as run but wraps the client in
+// a DryRunClient so no order is ever submitted.
+func dryRunCommand(args []string) int {
+	fs := newFlagSet("dry-run")
+	cf := addConfigFlags(fs)
+	useReal := fs.Bool("real", false, "log in and add to cart with the production TargetClient")
+	grace := fs.Duration("grace", orchestrator.DefaultGracePeriod, "on SIGINT/SIGTERM, let in-flight checkouts finish for this long")
+	sf := addSourceFlags(fs)
+	if code := parseFlags(fs, args); code >= 0 {
+		return code
+	}
+
+	cfg, err := cf.load()
+	if err != nil {
+		log.Printf("[dry-run] %v", err)
+		return exitInvalidConfig
+	}
+
+	return checkout("dry-run", cfg, sf, *useReal, true, *grace, nil, nil, orders.Options{})
+}
+
+// sourceFlags choose where stock events come from: the inventory monitor
+// or one simulated event per product. eventLog is where the run's state
+// changes go.
+type sourceFlags struct {
+	monitor    *bool
+	monitorURL *string
+	eventLog   *string
+}
+
+func addSourceFlags(fs *flag.FlagSet) sourceFlags {
+	return sourceFlags{
+		monitor: fs.Bool("monitor", false,
+			"poll inventory instead of simulating one stock event per product (implied by --real)"),
+		monitorURL: fs.String("monitor-url", "",
+			"poll this fulfillment endpoint over plain HTTP instead of Target's (e.g. a local fake); implies --monitor"),
+		eventLog: fs.String("event-log", "",
+			"append every worker state change to this file as JSON lines"),
+	}
+}
+
+// logEvents subscribes to orch's state changes and appends them to the
+// --event-log file. The returned channel is closed once every change has
+// been written after Run returns.
+func (sf sourceFlags) logEvents(orch *orchestrator.Orchestrator) (<-chan struct{}, error) {
+	done := make(chan struct{})
+	if *sf.eventLog == "" {
+		close(done)
+		return done, nil
+	}
+	f, err := os.OpenFile(*sf.eventLog, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open event log: %w", err)
+	}
+	changes, _ := orch.Subscribe(256)
+	go func() {
+		defer close(done)
+		defer f.Close()
+		enc := json.NewEncoder(f)
+		for c := range changes {
+			if err := enc.Encode(c); err != nil {
+				log.Printf("[event-log] %v", err)
+			}
+		}
+	}()
+	return done, nil
+}
+
+// events returns the stock event channel for the run and a function that
+// stops its source. Polling Target itself goes through a warmed-up
+// TargetSession so requests carry the same fingerprint as checkout.
+func (sf sourceFlags) events(ctx context.Context, name string, cfg orchestrator.Config, useReal bool) (<-chan models.StockEvent, func(), error) {
+	opts := cfg.Monitor
+	if *sf.monitorURL != "" {
+		opts.URL = *sf.monitorURL
+	}
+	products := cfg.WatchList()
+	if !useReal && !*sf.monitor && opts.URL == "" {
+		return simulatedEvents(products), func() {}, nil
+	}
+	if opts.Zip == "" && opts.State == "" {
+		profile, _ := cfg.DefaultProfile()
+		opts.Zip = profile.Shipping.ZipCode
+		opts.State = profile.Shipping.State
+	}
+
+	var doer monitor.Doer
+	if opts.URL != "" {
+		log.Printf("[%s] monitoring %s", name, opts.URL)
+		doer = monitor.HTTPDoer{Client: &http.Client{Timeout: 15 * time.Second}}
+	} else {
+		sess, err := session.NewTargetSession()
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create monitor session: %w", err)
+		}
+		if err := sess.WarmUp(ctx); err != nil {
+			return nil, nil, fmt.Errorf("failed to warm up monitor session: %w", err)
+		}
+		doer = sess
+	}
+
+	mon := monitor.NewTargetMonitor(doer, opts)
+	events, err := mon.Start(ctx, products)
+	if err != nil {
+		return nil, nil, err
+	}
+	return events, mon.Stop, nil
+}
+
+// simulatedEvents emits one stock event per product to exercise the
+// pipeline without polling.
+func simulatedEvents(products []models.TargetProduct) <-chan models.StockEvent {
+	events := make(chan models.StockEvent, len(products))
+	now := time.Now()
+	for _, p := range products {
+		events <- models.StockEvent{
+			Product:       p,
+			OfferID:       "test-offer",
+			LocationID:    "test-location",
+			DetectedAt:    now,
+			PreviousState: models.OutOfStock,
+		}
+	}
+	close(events)
+	return events
+}
+
+// checkout builds the orchestrator for cfg and feeds it stock events from
+// the source chosen by sf. Successful orders are appended to ledger when
+// it is non-nil, and followed with the order tracker afterwards when
+// track.Timeout is set.
+//
+// SIGINT or SIGTERM starts a graceful shutdown: no new events are taken
+// and in-flight checkouts get the grace period to finish. A second
+// signal kills the process immediately.
+func checkout(name string, cfg orchestrator.Config, sf sourceFlags, useReal, dryRun bool, grace time.Duration, ledger *history.Ledger, sessions *session.Store, track orders.Options) int {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		// Restore default signal handling so a second Ctrl-C force-quits.
+		stop()
+	}()
+
+	log.Printf("[%s] zeng_bot starting: %d tasks, %d products", name, len(cfg.TaskList()), len(cfg.WatchList()))
+
+	var clientFactory func(models.Profile) task.CheckoutClient
+	if useReal {
+		log.Printf("[%s] using real TargetClient", name)
+		clientFactory = func(profile models.Profile) task.CheckoutClient {
+			sess, err := session.NewTargetSession()
+			if err != nil {
+				log.Fatalf("[%s] failed to create session: %v", name, err)
+			}
+			client, err := task.NewTargetClient(ctx, sess, profile)
+			if err != nil {
+				log.Fatalf("[%s] failed to create target client: %v", name, err)
+			}
+			if sessions != nil {
+				saveSession(sessions, profile.Name, sess)
+			}
+			return client
+		}
+	} else {
+		log.Printf("[%s] using NoOpClient (pass --real for real requests)", name)
+		clientFactory = func(models.Profile) task.CheckoutClient {
+			return &task.NoOpClient{}
+		}
+	}
+	if dryRun {
+		inner := clientFactory
+		clientFactory = func(profile models.Profile) task.CheckoutClient {
+			return &task.DryRunClient{Client: inner(profile)}
+		}
+	}
+
+	// clients keeps the first client made for each profile so placed
+	// orders can be tracked with the account that placed them.
+	clients := make(map[string]task.CheckoutClient)
+	newClient := clientFactory
+	clientFactory = func(profile models.Profile) task.CheckoutClient {
+		c := newClient(profile)
+		if _, ok := clients[profile.Name]; !ok {
+			clients[profile.Name] = c
+		}
+		return c
+	}
+
+	orch, err := orchestrator.New(cfg, clientFactory)
+	if err != nil {
+		log.Printf("[%s] %v", name, err)
+		return exitInvalidConfig
+	}
+	orch.SetGracePeriod(grace)
+	var (
+		placedMu sync.Mutex
+		placed   []orders.Order
+	)
+	orch.OnResult(func(r task.Result, err error) {
+		// A dry run succeeds without an order ID and places nothing.
+		if r.OrderID == "" && (err == nil || !r.OrderMayExist(err)) {
+			return
+		}
+		// An order that may exist despite the error is recorded and
+		// tracked until Target reports its status.
+		status := models.OrderPlaced
+		if err != nil {
+			status = models.OrderUnconfirmed
+		}
+		if r.OrderID != "" {
+			placedMu.Lock()
+			placed = append(placed, orders.Order{
+				ID:      r.OrderID,
+				Profile: r.Profile,
+				TaskID:  r.TaskID,
+				TCIN:    r.Product.TCIN,
+				Status:  status,
+			})
+			placedMu.Unlock()
+		}
+		if ledger != nil {
+			rec := history.Record{
+				Time:     time.Now(),
+				OrderID:  r.OrderID,
+				CartID:   r.CartID,
+				Profile:  r.Profile,
+				TCIN:     r.Product.TCIN,
+				DPCI:     r.Product.DPCI,
+				Name:     r.Product.Name,
+				StoreID:  r.Product.StoreID,
+				WorkerID: r.WorkerID,
+				TaskID:   r.TaskID,
+				Quantity: r.Quantity,
+				Total:    r.Totals.GrandTotal,
+
+				Fulfillment:     string(r.Fulfillment),
+				PickupStoreID:   r.PickupStoreID,
+				PickupStoreName: r.PickupStoreName,
+				Tenders:         r.Tenders,
+			}
+			rec.SetStatus(status, rec.Time)
+			if err := ledger.Append(rec); err != nil {
+				log.Printf("[%s] failed to record order %s: %v", name, r.OrderID, err)
+			}
+		}
+	})
+
+	logDone, err := sf.logEvents(orch)
+	if err != nil {
+		log.Printf("[%s] %v", name, err)
+		return exitFailure
+	}
+	events, stopEvents, err := sf.events(ctx, name, cfg, useReal)
+	if err != nil {
+		log.Printf("[%s] %v", name, err)
+		return exitFailure
+	}
+	summary := orch.Run(ctx, events)
+	stopEvents()
+	<-logDone
+	log.Printf("[%s] zeng_bot finished.", name)
+	printSummary(summary)
+
+	var cancelled []orders.Order
+	if track.Timeout > 0 && len(placed) > 0 && ctx.Err() == nil {
+		log.Printf("[%s] tracking %d orders for up to %s", name, len(placed), track.Timeout)
+		cancelled = trackOrders(ctx, track, placed, clients, ledger)
+		printCancelled(cancelled)
+	}
+
+	switch {
+	case ctx.Err() != nil || len(summary.Interrupted) > 0:
+		return exitInterrupted
+	case summary.Failed > 0 || len(cancelled) > 0:
+		return exitCheckoutFailed
+	default:
+		return exitOK
+	}
+}
+
+// trackOrders follows the orders placed in a run with the client of the
+// profile that placed each, recording status changes in ledger if it is
+// non-nil. It returns the orders Target cancelled.
+func trackOrders(ctx context.Context, opts orders.Options, placed []orders.Order, clients map[string]task.CheckoutClient, ledger *history.Ledger) []orders.Order {
+	tracker := orders.NewTracker(opts)
+	tracker.OnUpdate(recordStatus(ledger))
+	for _, o := range placed {
+		src, ok := clients[o.Profile].(task.StatusChecker)
+		if !ok {
+			log.Printf("[tracker] cannot track order %s: client has no order status API", o.ID)
+			continue
+		}
+		tracker.Track(ctx, o, src)
+	}
+	tracker.Wait()
+	return tracker.Cancelled()
+}
+
+// recordStatus returns an update hook that saves each status change to
+// ledger. A nil ledger records nothing.
+func recordStatus(ledger *history.Ledger) func(orders.Update) {
+	return func(u orders.Update) {
+		if ledger == nil {
+			return
+		}
+		err := ledger.Update(u.Order.ID, func(r *history.Record) { r.SetStatus(u.To, u.At) })
+		if err != nil {
+			log.Printf("[tracker] failed to record status of order %s: %v", u.Order.ID, err)
+		}
+	}
+}
+
+// printCancelled lists orders Target cancelled after they were placed.
+func printCancelled(cancelled []orders.Order) {
+	for _, o := range cancelled {
+		fmt.Printf("  cancelled by Target: order %s, %s, profile %q, TCIN %s\n", o.ID, o.TaskID, o.Profile, o.TCIN)
+	}
+}
+
+// printSummary reports the run's outcome on stdout per task, listing
+// every attempt that shutdown cut short and the state it was in.
+func printSummary(s orchestrator.Summary) {
+	fmt.Printf("summary: %d attempts, %d succeeded, %d failed, %d interrupted\n",
+		s.Attempts, s.Succeeded, s.Failed, len(s.Interrupted))
+	if s.Spent > 0 {
+		fmt.Printf("  spent: %s\n", s.Spent)
+	}
+	for _, t := range s.Tasks {
+		fmt.Printf("  %s: %d attempts, %d succeeded, %d failed, %d interrupted\n",
+			t.TaskID, t.Attempts, t.Succeeded, t.Failed, t.Interrupted)
+	}
+	for _, r := range s.Partial {
+		fmt.Printf("  partial: %s worker %d, TCIN %s, order %s: %d of %d units\n",
+			r.TaskID, r.WorkerID, r.Product.TCIN, r.OrderID, r.Quantity, r.Requested)
+	}
+	for _, r := range s.Interrupted {
+		note := ""
+		if r.Stage.OrderMayExist() {
+			note = " (order outcome unknown, check the account's order history)"
+		}
+		fmt.Printf("  interrupted: %s worker %d, profile %q, TCIN %s, in state %s, cart %q%s\n",
+			r.TaskID, r.WorkerID, r.Profile, r.Product.TCIN, r.Stage, r.CartID, note)
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+
+	"zeng_bot/internal/models"
+	"zeng_bot/internal/session"
+	"zeng_bot/internal/task"
+)
+
+// savedSession is a TargetClient for one profile on the session saved in
+// a store, for commands that act on orders after the run that placed
+// them. Requests that find the session expired log in again once and are
+// retried. It is safe for concurrent use.
+type savedSession struct {
+	store   *session.Store
+	profile string
+	sess    *session.TargetSession
+	client  *task.TargetClient
+
+	loginMu sync.Mutex
+}
+
+// openSavedSession restores profile's saved session from store, or logs
+// in afresh if none is saved.
+func openSavedSession(ctx context.Context, store *session.Store, profile models.Profile) (*savedSession, error) {
+	sess, err := session.NewTargetSession()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create session: %w", err)
+	}
+	s := &savedSession{store: store, profile: profile.Name, sess: sess}
+	snap, err := store.Load(profile.Name)
+	if err == nil {
+		sess.Restore(snap)
+		s.client = task.ResumeTargetClient(sess, profile)
+		return s, nil
+	}
+	if !errors.Is(err, session.ErrNoSavedSession) {
+		log.Printf("[session] ignoring saved session: %v", err)
+	}
+	if s.client, err = task.NewTargetClient(ctx, sess, profile); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// OrderStatus reads the order's status.
+func (s *savedSession) OrderStatus(ctx context.Context, orderID string) (models.OrderStatus, error) {
+	var status models.OrderStatus
+	err := s.do(ctx, func() (err error) {
+		status, err = s.client.OrderStatus(ctx, orderID)
+		return err
+	})
+	return status, err
+}
+
+// CancelOrder asks Target to cancel the order.
+func (s *savedSession) CancelOrder(ctx context.Context, orderID, reason string) (models.OrderStatus, error) {
+	var status models.OrderStatus
+	err := s.do(ctx, func() (err error) {
+		status, err = s.client.CancelOrder(ctx, orderID, reason)
+		return err
+	})
+	return status, err
+}
+
+// do runs fn, logging in again and retrying once if the session has
+// expired.
+func (s *savedSession) do(ctx context.Context, fn func() error) error {
+	err := fn()
+	if !errors.Is(err, task.ErrSessionExpired) || ctx.Err() != nil {
+		return err
+	}
+	if lerr := s.relogin(ctx); lerr != nil {
+		return fmt.Errorf("%w (re-login failed: %w)", err, lerr)
+	}
+	return fn()
+}
+
+// relogin logs in again unless a concurrent request already has.
+func (s *savedSession) relogin(ctx context.Context) error {
+	s.loginMu.Lock()
+	defer s.loginMu.Unlock()
+	if s.client.LoggedIn() {
+		return nil
+	}
+	log.Printf("[session] saved session for %q has expired, logging in again", s.profile)
+	return s.client.Login(ctx)
+}
+
+// Save writes the session back to the store for later commands. A
+// session that expired and could not log in again is not worth keeping.
+func (s *savedSession) Save() {
+	if !s.client.LoggedIn() {
+		return
+	}
+	saveSession(s.store, s.profile, s.sess)
+}
+
+// saveSession saves sess as profile's session in store, logging any
+// failure.
+func saveSession(store *session.Store, profile string, sess *session.TargetSession) {
+	if err := store.Save(profile, sess.Snapshot()); err != nil {
+		log.Printf("[session] failed to save session for %q: %v", profile, err)
+	}
+}
+
+// compile-time check: savedSession serves the order commands.
+var (
+	_ task.StatusChecker  = (*savedSession)(nil)
+	_ task.OrderCanceller = (*savedSession)(nil)
+)
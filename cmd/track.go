@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"zeng_bot/internal/history"
+	"zeng_bot/internal/models"
+	"zeng_bot/internal/orders"
+	"zeng_bot/internal/session"
+	"zeng_bot/internal/task"
+)
+
+// trackCommand polls the status of orders in the history ledger that have
+// not reached a final status, recording every change in the ledger and
+// listing orders Target cancelled.
+func trackCommand(args []string) int {
+	fs := newFlagSet("track")
+	cf := addConfigFlags(fs)
+	useReal := fs.Bool("real", os.Getenv("USE_REAL_CLIENT") == "1",
+		"use the production TargetClient (default: NoOpClient, or $USE_REAL_CLIENT=1)")
+	historyPath := fs.String("history", "orders.jsonl", "order history ledger to read orders from and record status in")
+	sessionsDir := fs.String("sessions", "sessions", "directory of saved sessions to reuse and update")
+	orderID := fs.String("order", "", "track only this order ID")
+	interval := fs.Duration("interval", time.Minute, "time between status polls of one order")
+	timeout := fs.Duration("timeout", 30*time.Minute, "stop following an order after this long")
+	if code := parseFlags(fs, args); code >= 0 {
+		return code
+	}
+
+	cfg, err := cf.load()
+	if err != nil {
+		log.Printf("[track] %v", err)
+		return exitInvalidConfig
+	}
+
+	ledger := history.NewLedger(*historyPath)
+	records, err := ledger.List()
+	if err != nil {
+		log.Printf("[track] %v", err)
+		return exitFailure
+	}
+	var pending []history.Record
+	for _, r := range records {
+		switch {
+		case r.OrderID == "":
+			// An unconfirmed order whose ID was never learned cannot be
+			// polled.
+		case *orderID != "" && r.OrderID != *orderID:
+		case *orderID == "" && r.Status.Final():
+		default:
+			pending = append(pending, r)
+		}
+	}
+	if len(pending) == 0 {
+		if *orderID != "" {
+			log.Printf("[track] order %s is not in %s", *orderID, *historyPath)
+			return exitFailure
+		}
+		fmt.Println("no orders to track")
+		return exitOK
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	tracker := orders.NewTracker(orders.Options{Interval: *interval, Timeout: *timeout})
+	record := recordStatus(ledger)
+	var printMu sync.Mutex
+	tracker.OnUpdate(func(u orders.Update) {
+		record(u)
+		from := u.From
+		if from == "" {
+			from = "unknown"
+		}
+		printMu.Lock()
+		fmt.Printf("%s  order %s: %s -> %s\n", u.At.Local().Format(time.DateTime), u.Order.ID, from, u.To)
+		printMu.Unlock()
+	})
+
+	store := session.NewStore(*sessionsDir)
+	clients := make(map[string]task.StatusChecker)
+	for _, r := range pending {
+		client, ok := clients[r.Profile]
+		if !ok {
+			profile, found := cfg.LookupProfile(r.Profile)
+			if !found {
+				log.Printf("[track] skipping order %s: no profile named %q in the config", r.OrderID, r.Profile)
+				continue
+			}
+			client, err = statusClient(ctx, store, profile, *useReal)
+			if err != nil {
+				log.Printf("[track] skipping orders of profile %q: %v", r.Profile, err)
+			}
+			clients[r.Profile] = client
+		}
+		if client == nil {
+			continue
+		}
+		tracker.Track(ctx, orders.Order{
+			ID:              r.OrderID,
+			Profile:         r.Profile,
+			TaskID:          r.TaskID,
+			TCIN:            r.TCIN,
+			Status:          r.Status,
+			CancelRequested: r.Cancellation.Accepted(),
+		}, client)
+	}
+	tracker.Wait()
+	for _, client := range clients {
+		if saved, ok := client.(*savedSession); ok {
+			saved.Save()
+		}
+	}
+
+	cancelled := tracker.Cancelled()
+	printCancelled(cancelled)
+	switch {
+	case ctx.Err() != nil:
+		return exitInterrupted
+	case len(cancelled) > 0:
+		return exitCheckoutFailed
+	default:
+		return exitOK
+	}
+}
+
+// statusClient returns a client that can read order status for profile,
+// on its saved session when there is one.
+func statusClient(ctx context.Context, store *session.Store, profile models.Profile, useReal bool) (task.StatusChecker, error) {
+	if !useReal {
+		return &task.NoOpClient{}, nil
+	}
+	saved, err := openSavedSession(ctx, store, profile)
+	if err != nil {
+		return nil, err
+	}
+	return saved, nil
+}
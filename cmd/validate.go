@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+
+	"zeng_bot/internal/config"
+	"zeng_bot/internal/orchestrator"
+)
+
+// validateCommand loads and validates the config without creating any
+// sessions. With --export-* it also writes the loaded products and
+// profile as CSV so they can be edited in a spreadsheet and loaded back
+// with --products-csv and --profiles-csv.
+func validateCommand(args []string) int {
+	fs := newFlagSet("validate")
+	cf := addConfigFlags(fs)
+	exportProducts := fs.String("export-products", "", "write the loaded products to this CSV file")
+	exportProfiles := fs.String("export-profiles", "", "write the loaded profiles to this CSV file")
+	if code := parseFlags(fs, args); code >= 0 {
+		return code
+	}
+
+	cfg, err := cf.load()
+	if err != nil {
+		log.Printf("[validate] %v", err)
+		return exitInvalidConfig
+	}
+	workers := 0
+	for _, t := range cfg.TaskList() {
+		workers += t.Workers
+	}
+	fmt.Printf("config OK: %d tasks, %d products, %d workers, %d profiles, %d proxies\n",
+		len(cfg.TaskList()), len(cfg.WatchList()), workers, len(cfg.Profiles), len(cfg.Proxies))
+
+	if err := exportCSV(cfg, *exportProducts, *exportProfiles); err != nil {
+		log.Printf("[validate] %v", err)
+		return exitFailure
+	}
+	return exitOK
+}
+
+// exportCSV writes the config's products and profiles to CSV files.
+// Empty paths are skipped.
+func exportCSV(cfg orchestrator.Config, productsPath, profilesPath string) error {
+	if productsPath != "" {
+		if err := writeCSVFile(productsPath, func(w io.Writer) error {
+			return config.WriteProducts(w, cfg.WatchList())
+		}); err != nil {
+			return fmt.Errorf("failed to export products: %w", err)
+		}
+		log.Printf("[validate] exported %d products to %s", len(cfg.WatchList()), productsPath)
+	}
+	if profilesPath != "" {
+		if err := writeCSVFile(profilesPath, func(w io.Writer) error {
+			return config.WriteProfiles(w, cfg.Profiles)
+		}); err != nil {
+			return fmt.Errorf("failed to export profiles: %w", err)
+		}
+		log.Printf("[validate] exported %d profiles to %s", len(cfg.Profiles), profilesPath)
+	}
+	return nil
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"zeng_bot/internal/config"
+	"zeng_bot/internal/models"
+	"zeng_bot/internal/vault"
+
+	"golang.org/x/term"
+)
+
+// passphraseEnv lets scripts supply the vault passphrase without a prompt.
+const passphraseEnv = "ZENG_VAULT_PASSPHRASE"
+
+// vaultCommand manages the encrypted profile vault:
+//
+//	vault init   --vault FILE
+//	vault add    --vault FILE (--from-csv FILE | --from-config FILE) [--replace]
+//	vault list   --vault FILE
+//	vault remove --vault FILE NAME
+func vaultCommand(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "usage: zeng_bot vault <init|add|list|remove> [flags]")
+		return exitUsage
+	}
+
+	switch args[0] {
+	case "init":
+		return vaultInit(args[1:])
+	case "add":
+		return vaultAdd(args[1:])
+	case "list":
+		return vaultList(args[1:])
+	case "remove":
+		return vaultRemove(args[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "unknown vault command %q\n", args[0])
+		return exitUsage
+	}
+}
+
+func vaultInit(args []string) int {
+	fs := newFlagSet("vault init")
+	path := fs.String("vault", "profiles.vault", "vault file to create")
+	if code := parseFlags(fs, args); code >= 0 {
+		return code
+	}
+
+	passphrase, err := newPassphrase()
+	if err != nil {
+		log.Printf("[vault] %v", err)
+		return exitFailure
+	}
+	if _, err := vault.Create(*path, passphrase); err != nil {
+		log.Printf("[vault] %v", err)
+		return exitFailure
+	}
+	fmt.Printf("created empty vault %s\n", *path)
+	return exitOK
+}
+
+func vaultAdd(args []string) int {
+	fs := newFlagSet("vault add")
+	path := fs.String("vault", "profiles.vault", "vault file to update")
+	fromCSV := fs.String("from-csv", "", "import every profile from this CSV file")
+	fromConfig := fs.String("from-config", "", "import the profiles from this JSON or YAML config file")
+	replace := fs.Bool("replace", false, "overwrite profiles that already exist with the same name")
+	if code := parseFlags(fs, args); code >= 0 {
+		return code
+	}
+
+	var (
+		profiles []models.Profile
+		source   string
+		err      error
+	)
+	switch {
+	case *fromCSV != "" && *fromConfig == "":
+		source = *fromCSV
+		profiles, err = readCSVFile(*fromCSV, config.ReadProfiles)
+	case *fromConfig != "" && *fromCSV == "":
+		source = *fromConfig
+		profiles, err = readConfigProfiles(*fromConfig)
+	default:
+		fmt.Fprintln(os.Stderr, "exactly one of --from-csv or --from-config is required")
+		return exitUsage
+	}
+	if err != nil {
+		log.Printf("[vault] %s: %v", source, err)
+		return exitInvalidConfig
+	}
+
+	v, code := openVault(*path)
+	if v == nil {
+		return code
+	}
+	for _, p := range profiles {
+		if err := v.Add(p, *replace); err != nil {
+			log.Printf("[vault] %v", err)
+			return exitFailure
+		}
+	}
+	if err := v.Save(); err != nil {
+		log.Printf("[vault] %v", err)
+		return exitFailure
+	}
+
+	fmt.Printf("added %d profiles to %s\n", len(profiles), *path)
+	fmt.Printf("%s still holds cleartext credentials; delete it once you no longer need it\n", source)
+	return exitOK
+}
+
+func vaultList(args []string) int {
+	fs := newFlagSet("vault list")
+	path := fs.String("vault", "profiles.vault", "vault file to read")
+	if code := parseFlags(fs, args); code >= 0 {
+		return code
+	}
+
+	v, code := openVault(*path)
+	if v == nil {
+		return code
+	}
+
+	profiles := v.Profiles()
+	if len(profiles) == 0 {
+		fmt.Println("vault is empty")
+		return exitOK
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tEMAIL\tCARD\tEXP\tSHIP TO")
+	for _, p := range profiles {
+		// Saved cards get their expiry from the wallet.
+		exp := "-"
+		if p.Payment.ExpMonth != "" {
+			exp = p.Payment.ExpMonth + "/" + p.Payment.ExpYear
+		}
+		card := p.Payment.Masked()
+		if n := len(p.GiftCards); n > 0 {
+			card = fmt.Sprintf("%d gift cards + %s", n, card)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s, %s\n",
+			p.Name, maskEmail(p.Email), card, exp,
+			p.Shipping.City, p.Shipping.State)
+	}
+	if err := tw.Flush(); err != nil {
+		log.Printf("[vault] %v", err)
+		return exitFailure
+	}
+	return exitOK
+}
+
+func vaultRemove(args []string) int {
+	fs := newFlagSet("vault remove")
+	path := fs.String("vault", "profiles.vault", "vault file to update")
+	if code := parseFlags(fs, args); code >= 0 {
+		return code
+	}
+	if fs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: zeng_bot vault remove [--vault FILE] NAME")
+		return exitUsage
+	}
+	name := fs.Arg(0)
+
+	v, code := openVault(*path)
+	if v == nil {
+		return code
+	}
+	if err := v.Remove(name); err != nil {
+		log.Printf("[vault] %v", err)
+		return exitFailure
+	}
+	if err := v.Save(); err != nil {
+		log.Printf("[vault] %v", err)
+		return exitFailure
+	}
+	fmt.Printf("removed profile %q from %s\n", name, *path)
+	return exitOK
+}
+
+// readConfigProfiles returns the validated profiles from a config file.
+func readConfigProfiles(path string) ([]models.Profile, error) {
+	cfg, err := config.Parse(path)
+	if err != nil {
+		return nil, err
+	}
+	profiles := cfg.Profiles
+	for _, p := range profiles {
+		if err := config.ValidateProfile(p); err != nil {
+			return nil, fmt.Errorf("profile %q: %w", p.Name, err)
+		}
+	}
+	return profiles, nil
+}
+
+// openVault prompts for the passphrase and decrypts the vault at path.
+// On failure it logs the error and returns a nil vault and exit code.
+func openVault(path string) (*vault.Vault, int) {
+	passphrase, err := readPassphrase("Vault passphrase: ")
+	if err != nil {
+		log.Printf("[vault] %v", err)
+		return nil, exitFailure
+	}
+	v, err := vault.Open(path, passphrase)
+	if err != nil {
+		log.Printf("[vault] %s: %v", path, err)
+		if errors.Is(err, vault.ErrWrongPassphrase) {
+			return nil, exitLoginFailed
+		}
+		return nil, exitFailure
+	}
+	return v, exitOK
+}
+
+// stdin is shared by every prompt so buffered input is not lost between
+// them.
+var stdin = bufio.NewReader(os.Stdin)
+
+// readPassphrase returns $ZENG_VAULT_PASSPHRASE if set, otherwise reads a
+// line from stdin after printing prompt to stderr. A terminal does not
+// echo what is typed.
+func readPassphrase(prompt string) (string, error) {
+	if p := os.Getenv(passphraseEnv); p != "" {
+		return p, nil
+	}
+	fmt.Fprint(os.Stderr, prompt)
+	var line string
+	if fd := int(os.Stdin.Fd()); term.IsTerminal(fd) {
+		b, err := term.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return "", fmt.Errorf("failed to read passphrase: %w", err)
+		}
+		line = string(b)
+	} else {
+		var err error
+		line, err = stdin.ReadString('\n')
+		if err != nil && line == "" {
+			return "", fmt.Errorf("failed to read passphrase: %w", err)
+		}
+	}
+	passphrase := strings.TrimRight(line, "\r\n")
+	if passphrase == "" {
+		return "", fmt.Errorf("passphrase must not be empty")
+	}
+	return passphrase, nil
+}
+
+// newPassphrase reads the passphrase for a new vault. Typed at a
+// terminal, it must be entered twice, since a typo would lock the
+// profiles away for good.
+func newPassphrase() (string, error) {
+	passphrase, err := readPassphrase("New vault passphrase: ")
+	if err != nil || os.Getenv(passphraseEnv) != "" || !term.IsTerminal(int(os.Stdin.Fd())) {
+		return passphrase, err
+	}
+	again, err := readPassphrase("Repeat passphrase: ")
+	if err != nil {
+		return "", err
+	}
+	if again != passphrase {
+		return "", fmt.Errorf("passphrases do not match")
+	}
+	return passphrase, nil
+}
+
+// maskEmail keeps the first character of the local part and the domain.
+func maskEmail(email string) string {
+	at := strings.IndexByte(email, '@')
+	if at < 1 {
+		return "***"
+	}
+	return email[:1] + "***" + email[at:]
+}
@@ -0,0 +1,178 @@
+// Package budget caps how much a run may spend, in total, per profile and
+// per card. Workers reserve an order's total before placing it and commit
+// or release the reservation once the outcome is known, so concurrent
+// workers cannot overspend between them.
+package budget
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"zeng_bot/internal/models"
+)
+
+// ErrExceeded is wrapped by Reserve when an amount does not fit within a
+// limit.
+var ErrExceeded = errors.New("budget exceeded")
+
+// Limits are the spending caps for a run. Zero or missing entries mean no
+// limit.
+type Limits struct {
+	Total models.Money `json:"total,omitempty"`
+	// Profiles caps spending per profile name.
+	Profiles map[string]models.Money `json:"profiles,omitempty"`
+	// Cards caps spending per card, keyed by its last four digits.
+	Cards map[string]models.Money `json:"cards,omitempty"`
+}
+
+// Enabled reports whether any limit is set.
+func (l Limits) Enabled() bool {
+	return l.Total > 0 || len(l.Profiles) > 0 || len(l.Cards) > 0
+}
+
+// Reservation is an amount held against the ledger for one order.
+// CardAmount is the part of Amount charged to Card; gift cards pay the
+// rest.
+type Reservation struct {
+	Profile    string
+	Card       string
+	Amount     models.Money
+	CardAmount models.Money
+	settled    bool
+}
+
+// Ledger tracks committed and reserved spending against Limits. It is
+// safe for concurrent use.
+type Ledger struct {
+	mu     sync.Mutex
+	limits Limits
+	// held is spent plus reserved, the amount a new reservation must fit
+	// alongside; spent is committed only.
+	held, spent usage
+}
+
+type usage struct {
+	total    models.Money
+	profiles map[string]models.Money
+	cards    map[string]models.Money
+}
+
+func newUsage() usage {
+	return usage{profiles: make(map[string]models.Money), cards: make(map[string]models.Money)}
+}
+
+func (u usage) add(profile, card string, amount, cardAmount models.Money) {
+	u.profiles[profile] += amount
+	u.cards[card] += cardAmount
+}
+
+// New returns an empty ledger enforcing limits.
+func New(limits Limits) *Ledger {
+	return &Ledger{limits: limits, held: newUsage(), spent: newUsage()}
+}
+
+// Reserve holds amount for an order paid by profile, cardAmount of it
+// with the card ending in card. The run and profile limits count the
+// whole amount, the card's limit only its share. It fails with
+// ErrExceeded if any applicable limit would be passed, holding nothing.
+func (l *Ledger) Reserve(profile, card string, amount, cardAmount models.Money) (*Reservation, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	checks := []struct {
+		name   string
+		limit  models.Money
+		held   models.Money
+		amount models.Money
+	}{
+		{"run", l.limits.Total, l.held.total, amount},
+		{fmt.Sprintf("profile %q", profile), l.limits.Profiles[profile], l.held.profiles[profile], amount},
+		{"card ending " + card, l.limits.Cards[card], l.held.cards[card], cardAmount},
+	}
+	for _, c := range checks {
+		if c.limit > 0 && c.held+c.amount > c.limit {
+			return nil, fmt.Errorf("%w: %s would reach %s of %s (%s already committed or reserved)",
+				ErrExceeded, c.name, c.held+c.amount, c.limit, c.held)
+		}
+	}
+
+	l.held.total += amount
+	l.held.add(profile, card, amount, cardAmount)
+	return &Reservation{Profile: profile, Card: card, Amount: amount, CardAmount: cardAmount}, nil
+}
+
+// Commit records a reservation as spent. Settling a reservation twice
+// does nothing.
+func (l *Ledger) Commit(r *Reservation) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if r.settled {
+		return
+	}
+	r.settled = true
+	l.spent.total += r.Amount
+	l.spent.add(r.Profile, r.Card, r.Amount, r.CardAmount)
+}
+
+// Release returns a reservation's amount to the budget.
+func (l *Ledger) Release(r *Reservation) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if r.settled {
+		return
+	}
+	r.settled = true
+	l.held.total -= r.Amount
+	l.held.add(r.Profile, r.Card, -r.Amount, -r.CardAmount)
+}
+
+// Remaining returns the most a new order paid by profile could cost, and
+// false if neither the run nor the profile is limited. CardRemaining
+// covers the card's share.
+func (l *Ledger) Remaining(profile string) (models.Money, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var remaining models.Money
+	limited := false
+	for _, c := range []struct{ limit, held models.Money }{
+		{l.limits.Total, l.held.total},
+		{l.limits.Profiles[profile], l.held.profiles[profile]},
+	} {
+		if c.limit <= 0 {
+			continue
+		}
+		left := max(c.limit-c.held, 0)
+		if !limited || left < remaining {
+			remaining, limited = left, true
+		}
+	}
+	return remaining, limited
+}
+
+// CardRemaining returns how much more may be charged to the card ending
+// in card, and false if it has no limit.
+func (l *Ledger) CardRemaining(card string) (models.Money, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	limit := l.limits.Cards[card]
+	if limit <= 0 {
+		return 0, false
+	}
+	return max(limit-l.held.cards[card], 0), true
+}
+
+// Spent returns the total committed so far.
+func (l *Ledger) Spent() models.Money {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.spent.total
+}
+
+// CardKey returns the key a card is budgeted under: its last four
+// digits. A saved card named only by nickname has no key and is covered
+// by the total and profile limits alone.
+func CardKey(p models.Payment) string {
+	return p.Last4()
+}
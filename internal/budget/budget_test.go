@@ -0,0 +1,159 @@
+package budget
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"zeng_bot/internal/models"
+)
+
+func TestReserveConcurrentNeverExceedsLimits(t *testing.T) {
+	limits := Limits{
+		Total:    models.Dollars(1000),
+		Profiles: map[string]models.Money{"a": models.Dollars(600), "b": models.Dollars(700)},
+		Cards:    map[string]models.Money{"1111": models.Dollars(300)},
+	}
+	l := New(limits)
+
+	type order struct {
+		profile, card      string
+		amount, cardAmount models.Money
+	}
+	var orders []order
+	for i := 0; i < 200; i++ {
+		o := order{profile: "a", card: "1111", amount: models.Dollars(30), cardAmount: models.Dollars(30)}
+		if i%2 == 1 {
+			o.profile, o.card = "b", "2222"
+		}
+		if i%3 == 0 {
+			// Part paid by gift card.
+			o.cardAmount = models.Dollars(10)
+		}
+		orders = append(orders, o)
+	}
+
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		committed []*Reservation
+	)
+	for i, o := range orders {
+		wg.Add(1)
+		go func(i int, o order) {
+			defer wg.Done()
+			r, err := l.Reserve(o.profile, o.card, o.amount, o.cardAmount)
+			if errors.Is(err, ErrExceeded) {
+				return
+			}
+			if err != nil {
+				t.Errorf("Reserve: %v", err)
+				return
+			}
+			// Every fourth order fails and gives its share back.
+			if i%4 == 0 {
+				l.Release(r)
+				return
+			}
+			l.Commit(r)
+			mu.Lock()
+			committed = append(committed, r)
+			mu.Unlock()
+		}(i, o)
+	}
+	wg.Wait()
+
+	var total models.Money
+	profiles := make(map[string]models.Money)
+	cards := make(map[string]models.Money)
+	for _, r := range committed {
+		total += r.Amount
+		profiles[r.Profile] += r.Amount
+		cards[r.Card] += r.CardAmount
+	}
+	if total > limits.Total {
+		t.Errorf("committed %s, over the run limit of %s", total, limits.Total)
+	}
+	for name, limit := range limits.Profiles {
+		if profiles[name] > limit {
+			t.Errorf("profile %s committed %s, over its limit of %s", name, profiles[name], limit)
+		}
+	}
+	for card, limit := range limits.Cards {
+		if cards[card] > limit {
+			t.Errorf("card %s committed %s, over its limit of %s", card, cards[card], limit)
+		}
+	}
+	if spent := l.Spent(); spent != total {
+		t.Errorf("Spent = %s, want the %s committed", spent, total)
+	}
+}
+
+func TestReserveExceededHoldsNothing(t *testing.T) {
+	l := New(Limits{
+		Total: models.Dollars(100),
+		Cards: map[string]models.Money{"1111": models.Dollars(50)},
+	})
+	if _, err := l.Reserve("a", "1111", models.Dollars(60), models.Dollars(60)); !errors.Is(err, ErrExceeded) {
+		t.Fatalf("Reserve over the card limit = %v, want ErrExceeded", err)
+	}
+	if left, _ := l.Remaining("a"); left != models.Dollars(100) {
+		t.Errorf("Remaining after a refused reservation = %s, want $100.00", left)
+	}
+	// Only the card's share counts against the card limit.
+	if _, err := l.Reserve("a", "1111", models.Dollars(90), models.Dollars(50)); err != nil {
+		t.Errorf("Reserve with a gift card share: %v", err)
+	}
+}
+
+func TestReleaseReturnsReservation(t *testing.T) {
+	l := New(Limits{
+		Total:    models.Dollars(100),
+		Profiles: map[string]models.Money{"a": models.Dollars(80)},
+		Cards:    map[string]models.Money{"1111": models.Dollars(50)},
+	})
+	r, err := l.Reserve("a", "1111", models.Dollars(40), models.Dollars(30))
+	if err != nil {
+		t.Fatalf("Reserve: %v", err)
+	}
+	if left, _ := l.Remaining("a"); left != models.Dollars(40) {
+		t.Errorf("Remaining while reserved = %s, want $40.00", left)
+	}
+	if left, _ := l.CardRemaining("1111"); left != models.Dollars(20) {
+		t.Errorf("CardRemaining while reserved = %s, want $20.00", left)
+	}
+
+	l.Release(r)
+	if left, _ := l.Remaining("a"); left != models.Dollars(80) {
+		t.Errorf("Remaining after Release = %s, want $80.00", left)
+	}
+	if left, _ := l.CardRemaining("1111"); left != models.Dollars(50) {
+		t.Errorf("CardRemaining after Release = %s, want $50.00", left)
+	}
+
+	// A settled reservation stays settled.
+	l.Release(r)
+	l.Commit(r)
+	if left, _ := l.Remaining("a"); left != models.Dollars(80) {
+		t.Errorf("Remaining after settling twice = %s, want $80.00", left)
+	}
+	if spent := l.Spent(); spent != 0 {
+		t.Errorf("Spent = %s, want 0 for a released reservation", spent)
+	}
+}
+
+func TestCommitKeepsAmountHeld(t *testing.T) {
+	l := New(Limits{Total: models.Dollars(100)})
+	r, err := l.Reserve("a", "", models.Dollars(70), models.Dollars(70))
+	if err != nil {
+		t.Fatalf("Reserve: %v", err)
+	}
+	l.Commit(r)
+	l.Release(r)
+	if spent := l.Spent(); spent != models.Dollars(70) {
+		t.Errorf("Spent = %s, want $70.00", spent)
+	}
+	if _, err := l.Reserve("a", "", models.Dollars(40), models.Dollars(40)); !errors.Is(err, ErrExceeded) {
+		t.Errorf("Reserve past committed spending = %v, want ErrExceeded", err)
+	}
+}
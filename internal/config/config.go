@@ -0,0 +1,112 @@
+// Package config loads and validates the orchestrator configuration from
+// JSON or YAML files.
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"zeng_bot/internal/orchestrator"
+	"zeng_bot/internal/validation"
+)
+
+// Load reads the config file at path, decodes it according to its
+// extension (.json, .yaml or .yml) and validates every field. It returns
+// a *ValidationError listing all problems if the config is invalid.
+func Load(path string) (orchestrator.Config, error) {
+	cfg, err := Parse(path)
+	if err != nil {
+		return cfg, err
+	}
+	if err := Validate(cfg); err != nil {
+		return cfg, err
+	}
+	return cfg, nil
+}
+
+// Parse reads and decodes the config file at path and normalizes the
+// profiles, without validating them. Unknown keys are rejected so that typos
+// fail early instead of being silently ignored.
+func Parse(path string) (orchestrator.Config, error) {
+	var cfg orchestrator.Config
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, fmt.Errorf("failed to read config: %w", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+	case ".yaml", ".yml":
+		raw, err = yamlToJSON(raw)
+		if err != nil {
+			return cfg, fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+	default:
+		return cfg, fmt.Errorf("unsupported config format %q (want .json, .yaml or .yml)", filepath.Ext(path))
+	}
+
+	// Configs from before multiple profiles had a single "profile" key.
+	var old struct {
+		Profile *json.RawMessage `json:"profile"`
+	}
+	if json.Unmarshal(raw, &old) == nil && old.Profile != nil {
+		return cfg, fmt.Errorf("failed to parse %s: the single \"profile\" key was replaced by a \"profiles\" list", path)
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&cfg); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) && typeErr.Field != "" {
+			return cfg, fmt.Errorf("failed to parse %s: %s", path, typeMismatch(typeErr))
+		}
+		return cfg, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	for i := range cfg.Profiles {
+		cfg.Profiles[i] = validation.NormalizeProfile(cfg.Profiles[i])
+	}
+	return cfg, nil
+}
+
+// typeMismatch describes a value of the wrong type by the field it is in.
+// YAML reads unquoted digits, such as a store ID or ZIP code, as a
+// number, which a string field does not accept.
+func typeMismatch(e *json.UnmarshalTypeError) string {
+	var field strings.Builder
+	for i, part := range strings.Split(e.Field, ".") {
+		switch {
+		case validation.AllDigits(part):
+			fmt.Fprintf(&field, "[%s]", part)
+		case i > 0:
+			field.WriteString("." + part)
+		default:
+			field.WriteString(part)
+		}
+	}
+	if e.Type.Kind() == reflect.String {
+		return fmt.Sprintf("%s: must be a string, got a %s (put the value in quotes)", field.String(), e.Value)
+	}
+	return fmt.Sprintf("%s: got a %s, want %s", field.String(), e.Value, e.Type)
+}
+
+// yamlToJSON converts a YAML document into JSON so that both formats are
+// decoded through the same json struct tags on the models.
+func yamlToJSON(raw []byte) ([]byte, error) {
+	var doc interface{}
+	if err := yaml.Unmarshal(raw, &doc); err != nil {
+		return nil, err
+	}
+	if doc == nil {
+		doc = map[string]interface{}{}
+	}
+	return json.Marshal(doc)
+}
@@ -0,0 +1,53 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// parseString parses contents as a config file with the given extension.
+func parseString(t *testing.T, ext, contents string) error {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config"+ext)
+	if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	_, err := Parse(path)
+	return err
+}
+
+func TestParseTypeMismatch(t *testing.T) {
+	tests := []struct {
+		name     string
+		ext      string
+		contents string
+		want     string
+	}{
+		{"unquoted YAML store ID", ".yaml", "products:\n  - tcin: \"89828965\"\n    store_id: 1375\n",
+			"products[0].store_id: must be a string, got a number (put the value in quotes)"},
+		{"unquoted YAML ZIP code", ".yml", "profiles:\n  - name: main\n    billing:\n      zip_code: 55403\n",
+			"profiles[0].billing.zip_code: must be a string, got a number"},
+		{"YAML boolean", ".yaml", "tasks:\n  - product:\n      tcin: true\n",
+			"tasks[0].product.tcin: must be a string, got a bool"},
+		{"JSON number", ".json", `{"products":[{"tcin":89828965}]}`,
+			"products[0].tcin: must be a string, got a number"},
+		{"string for a number", ".yaml", "worker_count: \"3\"\n",
+			"worker_count: got a string, want int"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := parseString(t, tt.ext, tt.contents)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Parse = %v, want an error containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseQuotedYAMLNumbers(t *testing.T) {
+	if err := parseString(t, ".yaml", "products:\n  - tcin: \"89828965\"\n    store_id: \"1375\"\n"); err != nil {
+		t.Errorf("Parse: %v", err)
+	}
+}
@@ -0,0 +1,255 @@
+package config
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"zeng_bot/internal/models"
+	"zeng_bot/internal/validation"
+)
+
+// column maps a CSV header to a string field on T. Nested structs are
+// flattened with a prefix, e.g. billing_zip_code -> Profile.Billing.ZipCode.
+type column[T any] struct {
+	name  string
+	field func(*T) *string
+}
+
+var productColumns = []column[models.TargetProduct]{
+	{"dpci", func(p *models.TargetProduct) *string { return &p.DPCI }},
+	{"tcin", func(p *models.TargetProduct) *string { return &p.TCIN }},
+	{"name", func(p *models.TargetProduct) *string { return &p.Name }},
+	{"store_id", func(p *models.TargetProduct) *string { return &p.StoreID }},
+}
+
+var profileColumns = buildProfileColumns()
+
+func buildProfileColumns() []column[models.Profile] {
+	cols := []column[models.Profile]{
+		{"name", func(p *models.Profile) *string { return &p.Name }},
+		{"email", func(p *models.Profile) *string { return &p.Email }},
+		{"password", func(p *models.Profile) *string { return &p.Password }},
+		{"phone", func(p *models.Profile) *string { return &p.Phone }},
+	}
+	cols = append(cols, addressColumns("billing", func(p *models.Profile) *models.Address { return &p.Billing })...)
+	cols = append(cols, addressColumns("shipping", func(p *models.Profile) *models.Address { return &p.Shipping })...)
+	for n := 1; n <= csvGiftCards; n++ {
+		cols = append(cols, giftCardColumns(n)...)
+	}
+	return append(cols,
+		column[models.Profile]{"payment_saved_card", func(p *models.Profile) *string { return &p.Payment.SavedCard }},
+		column[models.Profile]{"payment_card_number", func(p *models.Profile) *string { return &p.Payment.CardNumber }},
+		column[models.Profile]{"payment_exp_month", func(p *models.Profile) *string { return &p.Payment.ExpMonth }},
+		column[models.Profile]{"payment_exp_year", func(p *models.Profile) *string { return &p.Payment.ExpYear }},
+		column[models.Profile]{"payment_cvv", func(p *models.Profile) *string { return &p.Payment.CVV }},
+	)
+}
+
+// csvGiftCards is how many gift cards a profiles CSV has columns for.
+const csvGiftCards = 3
+
+// giftCardColumns maps gift_card_<n>_number and gift_card_<n>_pin to the
+// profile's nth gift card, adding empty cards up to it as needed.
+// NormalizeProfile drops the ones left blank.
+func giftCardColumns(n int) []column[models.Profile] {
+	card := func(p *models.Profile) *models.GiftCard {
+		for len(p.GiftCards) < n {
+			p.GiftCards = append(p.GiftCards, models.GiftCard{})
+		}
+		return &p.GiftCards[n-1]
+	}
+	prefix := fmt.Sprintf("gift_card_%d", n)
+	return []column[models.Profile]{
+		{prefix + "_number", func(p *models.Profile) *string { return &card(p).Number }},
+		{prefix + "_pin", func(p *models.Profile) *string { return &card(p).PIN }},
+	}
+}
+
+func addressColumns(prefix string, addr func(*models.Profile) *models.Address) []column[models.Profile] {
+	return []column[models.Profile]{
+		{prefix + "_line1", func(p *models.Profile) *string { return &addr(p).Line1 }},
+		{prefix + "_line2", func(p *models.Profile) *string { return &addr(p).Line2 }},
+		{prefix + "_city", func(p *models.Profile) *string { return &addr(p).City }},
+		{prefix + "_state", func(p *models.Profile) *string { return &addr(p).State }},
+		{prefix + "_zip_code", func(p *models.Profile) *string { return &addr(p).ZipCode }},
+		{prefix + "_country", func(p *models.Profile) *string { return &addr(p).Country }},
+	}
+}
+
+// RowError describes a problem with a single CSV row. Column is the CSV
+// header of the offending value, or empty if the whole row is bad.
+type RowError struct {
+	Line    int
+	Column  string
+	Message string
+}
+
+func (e RowError) Error() string {
+	if e.Column == "" {
+		return fmt.Sprintf("line %d: %s", e.Line, e.Message)
+	}
+	return fmt.Sprintf("line %d: %s: %s", e.Line, e.Column, e.Message)
+}
+
+// CSVError collects every RowError found in a CSV file.
+type CSVError struct {
+	Rows []RowError
+}
+
+func (e *CSVError) Error() string {
+	lines := make([]string, 0, len(e.Rows)+1)
+	lines = append(lines, fmt.Sprintf("invalid CSV (%d problems):", len(e.Rows)))
+	for _, r := range e.Rows {
+		lines = append(lines, "  "+r.Error())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// ReadProducts parses a product watchlist CSV. The first row must be a
+// header using the column names dpci, tcin, name and store_id, in any
+// order; only tcin is required.
+func ReadProducts(r io.Reader) ([]models.TargetProduct, error) {
+	return readCSV(r, productColumns, func(v *validator, p *models.TargetProduct) {
+		v.product("", *p)
+	})
+}
+
+// WriteProducts writes products as CSV in the format read by ReadProducts.
+func WriteProducts(w io.Writer, products []models.TargetProduct) error {
+	return writeCSV(w, productColumns, products)
+}
+
+// ReadProfiles parses a profiles CSV. Nested address and payment fields
+// use prefixed columns such as billing_zip_code and payment_cvv, and gift
+// cards numbered columns such as gift_card_1_pin. Every row is normalized
+// and validated with the same rules as the config file.
+func ReadProfiles(r io.Reader) ([]models.Profile, error) {
+	return readCSV(r, profileColumns, func(v *validator, p *models.Profile) {
+		*p = validation.NormalizeProfile(*p)
+		v.profile("", *p)
+	})
+}
+
+// WriteProfiles writes profiles as CSV in the format read by ReadProfiles.
+func WriteProfiles(w io.Writer, profiles []models.Profile) error {
+	for _, p := range profiles {
+		if len(p.GiftCards) > csvGiftCards {
+			return fmt.Errorf("profile %q has %d gift cards, CSV holds at most %d", p.Name, len(p.GiftCards), csvGiftCards)
+		}
+	}
+	return writeCSV(w, profileColumns, profiles)
+}
+
+// readCSV decodes rows into T using the header to locate columns, then
+// runs check on each row, which may normalize it in place, and reports
+// failures by line number.
+func readCSV[T any](r io.Reader, columns []column[T], check func(*validator, *T)) ([]T, error) {
+	cr := csv.NewReader(r)
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("CSV is empty, expected a header row")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CSV header: %w", err)
+	}
+
+	byName := make(map[string]column[T], len(columns))
+	for _, c := range columns {
+		byName[c.name] = c
+	}
+	fields := make([]column[T], len(header))
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		c, ok := byName[name]
+		if !ok {
+			return nil, RowError{Line: 1, Column: name, Message: "unknown column"}
+		}
+		fields[i] = c
+	}
+
+	var (
+		out     []T
+		rowErrs []RowError
+	)
+	for {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				rowErrs = append(rowErrs, RowError{Line: parseErr.Line, Message: parseErr.Err.Error()})
+				continue
+			}
+			return nil, fmt.Errorf("failed to read CSV: %w", err)
+		}
+		line, _ := cr.FieldPos(0)
+
+		var item T
+		for i, value := range record {
+			*fields[i].field(&item) = strings.TrimSpace(value)
+		}
+
+		v := &validator{now: time.Now()}
+		check(v, &item)
+		for _, fe := range v.errors {
+			rowErrs = append(rowErrs, RowError{Line: line, Column: csvColumn(fe.Field), Message: fe.Message})
+		}
+		out = append(out, item)
+	}
+
+	if len(rowErrs) > 0 {
+		return nil, &CSVError{Rows: rowErrs}
+	}
+	return out, nil
+}
+
+// giftCardField matches the gift card index in a validator field path.
+var giftCardField = regexp.MustCompile(`^gift_cards\[(\d+)\]\.`)
+
+// csvColumn converts a validator field path such as ".billing.zip_code"
+// to its flattened CSV column name "billing_zip_code". Gift cards are
+// numbered from 1, so ".gift_cards[0].pin" is "gift_card_1_pin".
+func csvColumn(field string) string {
+	field = strings.TrimPrefix(field, ".")
+	if m := giftCardField.FindStringSubmatch(field); m != nil {
+		i, _ := strconv.Atoi(m[1])
+		field = fmt.Sprintf("gift_card_%d_", i+1) + field[len(m[0]):]
+	}
+	return strings.ReplaceAll(field, ".", "_")
+}
+
+func writeCSV[T any](w io.Writer, columns []column[T], items []T) error {
+	cw := csv.NewWriter(w)
+
+	header := make([]string, len(columns))
+	for i, c := range columns {
+		header[i] = c.name
+	}
+	if err := cw.Write(header); err != nil {
+		return fmt.Errorf("failed to write CSV header: %w", err)
+	}
+
+	for _, item := range items {
+		item := item
+		record := make([]string, len(columns))
+		for i, c := range columns {
+			record[i] = *c.field(&item)
+		}
+		if err := cw.Write(record); err != nil {
+			return fmt.Errorf("failed to write CSV row: %w", err)
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
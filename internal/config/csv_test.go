@@ -0,0 +1,144 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"zeng_bot/internal/models"
+)
+
+func TestProfilesCSVRoundTrip(t *testing.T) {
+	withCards := validProfile("gift cards")
+	withCards.Shipping.Line2 = "Apt 4, rear door"
+	withCards.GiftCards = []models.GiftCard{
+		{Number: "041234567890123", PIN: "12345678"},
+		{Number: "041234567890124", PIN: "1234"},
+	}
+	savedCard := validProfile("saved card")
+	savedCard.Payment = models.Payment{SavedCard: "1111", CVV: "123"}
+	profiles := []models.Profile{validProfile("plain"), withCards, savedCard}
+
+	var buf bytes.Buffer
+	if err := WriteProfiles(&buf, profiles); err != nil {
+		t.Fatalf("WriteProfiles: %v", err)
+	}
+	got, err := ReadProfiles(&buf)
+	if err != nil {
+		t.Fatalf("ReadProfiles: %v", err)
+	}
+	if !reflect.DeepEqual(got, profiles) {
+		t.Errorf("round trip changed the profiles:\n got %+v\nwant %+v", got, profiles)
+	}
+}
+
+func TestWriteProfilesTooManyGiftCards(t *testing.T) {
+	p := validProfile("main")
+	for i := 0; i <= csvGiftCards; i++ {
+		p.GiftCards = append(p.GiftCards, models.GiftCard{Number: "041234567890123", PIN: "1234"})
+	}
+	if err := WriteProfiles(&bytes.Buffer{}, []models.Profile{p}); err == nil {
+		t.Error("WriteProfiles accepted more gift cards than the CSV has columns for")
+	}
+}
+
+func TestProductsCSVRoundTrip(t *testing.T) {
+	products := []models.TargetProduct{
+		{DPCI: "000-00-0000", TCIN: "89828965", Name: `Example, "quoted"`, StoreID: "1375"},
+		{TCIN: "12345678"},
+	}
+	var buf bytes.Buffer
+	if err := WriteProducts(&buf, products); err != nil {
+		t.Fatalf("WriteProducts: %v", err)
+	}
+	got, err := ReadProducts(&buf)
+	if err != nil {
+		t.Fatalf("ReadProducts: %v", err)
+	}
+	if !reflect.DeepEqual(got, products) {
+		t.Errorf("round trip changed the products:\n got %+v\nwant %+v", got, products)
+	}
+}
+
+func TestReadCSVRowErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		csv  string
+		want []RowError
+	}{
+		{
+			name: "bad value",
+			csv:  "tcin,store_id\n89828965,1375\n12345678,T1375\n",
+			want: []RowError{{Line: 3, Column: "store_id"}},
+		},
+		{
+			name: "after a multi-line value",
+			csv:  "name,tcin\n\"two\nlines\",89828965\nthird,A-1\n",
+			want: []RowError{{Line: 4, Column: "tcin"}},
+		},
+		{
+			name: "every bad row",
+			csv:  "tcin\nx\n89828965\n\ny\n",
+			want: []RowError{{Line: 2, Column: "tcin"}, {Line: 5, Column: "tcin"}},
+		},
+		{
+			name: "wrong field count",
+			csv:  "tcin,name\n89828965,ok\n12345678\n",
+			want: []RowError{{Line: 3}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ReadProducts(strings.NewReader(tt.csv))
+			var csvErr *CSVError
+			if !errors.As(err, &csvErr) {
+				t.Fatalf("ReadProducts = %v, want a *CSVError", err)
+			}
+			if len(csvErr.Rows) != len(tt.want) {
+				t.Fatalf("row errors = %v, want %d", csvErr.Rows, len(tt.want))
+			}
+			for i, want := range tt.want {
+				if got := csvErr.Rows[i]; got.Line != want.Line || got.Column != want.Column {
+					t.Errorf("row error %d = %v, want line %d column %q", i, got, want.Line, want.Column)
+				}
+			}
+		})
+	}
+}
+
+func TestReadProfilesRowErrorColumns(t *testing.T) {
+	bad := validProfile("bad")
+	bad.Billing.ZipCode = "5540"
+	bad.GiftCards = []models.GiftCard{{Number: "041234567890123", PIN: "12"}}
+	var buf bytes.Buffer
+	if err := WriteProfiles(&buf, []models.Profile{validProfile("good"), bad}); err != nil {
+		t.Fatalf("WriteProfiles: %v", err)
+	}
+
+	_, err := ReadProfiles(&buf)
+	var csvErr *CSVError
+	if !errors.As(err, &csvErr) {
+		t.Fatalf("ReadProfiles = %v, want a *CSVError", err)
+	}
+	var got []string
+	for _, r := range csvErr.Rows {
+		if r.Line != 3 {
+			t.Errorf("row error %v on line %d, want 3", r, r.Line)
+		}
+		got = append(got, r.Column)
+	}
+	want := []string{"billing_zip_code", "gift_card_1_pin"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("row error columns = %q, want %q", got, want)
+	}
+}
+
+func TestReadCSVUnknownColumn(t *testing.T) {
+	_, err := ReadProducts(strings.NewReader("tcin,colour\n89828965,red\n"))
+	var rowErr RowError
+	if !errors.As(err, &rowErr) || rowErr.Line != 1 || rowErr.Column != "colour" {
+		t.Errorf("ReadProducts = %v, want an unknown column error on line 1", err)
+	}
+}
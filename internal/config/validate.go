@@ -0,0 +1,274 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"zeng_bot/internal/budget"
+	"zeng_bot/internal/models"
+	"zeng_bot/internal/monitor"
+	"zeng_bot/internal/orchestrator"
+	"zeng_bot/internal/task"
+	"zeng_bot/internal/validation"
+)
+
+// FieldError describes a single invalid config field. Field is the JSON
+// path of the value, e.g. "products[0].tcin".
+type FieldError = validation.FieldError
+
+// ValidationError collects every FieldError found in a config so the user
+// can fix them all in one pass.
+type ValidationError struct {
+	Fields []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	lines := make([]string, 0, len(e.Fields)+1)
+	lines = append(lines, fmt.Sprintf("invalid config (%d problems):", len(e.Fields)))
+	for _, f := range e.Fields {
+		lines = append(lines, "  "+f.Error())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// validator accumulates field errors while walking a config.
+type validator struct {
+	now    time.Time
+	errors []FieldError
+}
+
+func (v *validator) add(field, format string, args ...interface{}) {
+	v.errors = append(v.errors, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// Validate checks every field of cfg and returns a *ValidationError if
+// any are missing or malformed. It performs no network requests.
+func Validate(cfg orchestrator.Config) error {
+	v := &validator{now: time.Now()}
+
+	if len(cfg.Tasks) == 0 && cfg.WorkerCount < 1 {
+		v.add("worker_count", "must be at least 1, got %d", cfg.WorkerCount)
+	} else if cfg.WorkerCount < 0 {
+		v.add("worker_count", "must not be negative, got %d", cfg.WorkerCount)
+	}
+
+	if len(cfg.Profiles) == 0 {
+		v.add("profiles", "at least one profile is required")
+	}
+	names := make(map[string]bool, len(cfg.Profiles))
+	for i, p := range cfg.Profiles {
+		path := fmt.Sprintf("profiles[%d]", i)
+		v.profile(path, p)
+		if p.Name != "" && names[p.Name] {
+			v.add(path+".name", "duplicate profile name %q", p.Name)
+		}
+		names[p.Name] = true
+	}
+
+	switch {
+	case len(cfg.Products) == 0 && len(cfg.Tasks) == 0:
+		v.add("products", "at least one product or task is required")
+	case len(cfg.Products) > 0 && len(cfg.Tasks) > 0:
+		v.add("products", "set either products or tasks, not both")
+	}
+	for i, p := range cfg.Products {
+		v.product(fmt.Sprintf("products[%d]", i), p)
+	}
+	// IDs are checked after defaults so an explicit "task-2" cannot
+	// collide with the ID given to an unnamed second task.
+	tasks := cfg.TaskList()
+	ids := make(map[string]bool, len(cfg.Tasks))
+	for i, t := range cfg.Tasks {
+		path := fmt.Sprintf("tasks[%d]", i)
+		v.task(path, t, cfg)
+		if id := tasks[i].ID; ids[id] {
+			v.add(path+".id", "duplicate task ID %q", id)
+		} else {
+			ids[id] = true
+		}
+	}
+	if len(cfg.Tasks) > 0 && len(cfg.EnabledTasks()) == 0 {
+		v.add("tasks", "every task is disabled")
+	}
+
+	for i, p := range cfg.Proxies {
+		v.proxy(fmt.Sprintf("proxies[%d]", i), p)
+	}
+
+	v.monitor("monitor", cfg.Monitor)
+	if cfg.MaxEventAge < 0 {
+		v.add("max_event_age", "must not be negative, got %s", cfg.MaxEventAge.D())
+	}
+	v.retry("retry", cfg.Retry)
+	v.budget("budget", cfg.Budget, cfg)
+
+	if len(v.errors) > 0 {
+		return &ValidationError{Fields: v.errors}
+	}
+	return nil
+}
+
+// ValidateProfile checks a single profile with the same rules Validate
+// applies to each of the config's profiles.
+func ValidateProfile(p models.Profile) error {
+	v := &validator{now: time.Now()}
+	v.profile("profile", p)
+	if len(v.errors) > 0 {
+		return &ValidationError{Fields: v.errors}
+	}
+	return nil
+}
+
+func (v *validator) product(path string, p models.TargetProduct) {
+	switch {
+	case p.TCIN == "":
+		v.add(path+".tcin", "required")
+	case !validation.AllDigits(p.TCIN):
+		v.add(path+".tcin", "must be numeric, got %q", p.TCIN)
+	}
+	if p.StoreID != "" && !validation.AllDigits(p.StoreID) {
+		v.add(path+".store_id", "must be numeric, got %q", p.StoreID)
+	}
+}
+
+func (v *validator) task(path string, t models.Task, cfg orchestrator.Config) {
+	v.product(path+".product", t.Product)
+	if _, ok := cfg.LookupProfile(t.Profile); !ok {
+		v.add(path+".profile", "no profile named %q", t.Profile)
+	}
+	if t.Quantity < 0 {
+		v.add(path+".quantity", "must not be negative, got %d", t.Quantity)
+	}
+	if t.Workers < 0 {
+		v.add(path+".workers", "must not be negative, got %d", t.Workers)
+	}
+	if t.MaxPrice < 0 {
+		v.add(path+".max_price", "must not be negative, got %s", t.MaxPrice)
+	}
+	if t.MaxTotal < 0 {
+		v.add(path+".max_total", "must not be negative, got %s", t.MaxTotal)
+	}
+	if (t.Fulfillment == models.FulfillmentPickup || t.Fulfillment == models.FulfillmentDriveUp) && t.Product.StoreID == "" {
+		v.add(path+".product.store_id", "required for %s fulfillment", t.Fulfillment)
+	}
+}
+
+// profile delegates to the validation package so the config file, CSV
+// imports and the vault all apply the same profile rules.
+func (v *validator) profile(path string, p models.Profile) {
+	v.errors = append(v.errors, validation.Profile(path, p, v.now)...)
+}
+
+func (v *validator) proxy(path string, p models.Proxy) {
+	if p.Host == "" {
+		v.add(path+".host", "required")
+	}
+	port, err := strconv.Atoi(p.Port)
+	if err != nil || port < 1 || port > 65535 {
+		v.add(path+".port", "must be 1-65535, got %q", p.Port)
+	}
+	if (p.Username == "") != (p.Password == "") {
+		v.add(path, "username and password must be set together")
+	}
+}
+
+func (v *validator) monitor(path string, o monitor.Options) {
+	if o.URL != "" {
+		u, err := url.Parse(o.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			v.add(path+".url", "must be an http(s) URL, got %q", o.URL)
+		}
+	}
+	durations := []struct {
+		name  string
+		value models.Duration
+	}{
+		{"interval", o.Interval},
+		{"jitter", o.Jitter},
+		{"host_interval", o.HostInterval},
+		{"max_backoff", o.MaxBackoff},
+		{"debounce", o.Debounce},
+		{"rearm_after", o.ReArmAfter},
+	}
+	for _, d := range durations {
+		if d.value < 0 {
+			v.add(path+"."+d.name, "must not be negative, got %s", d.value.D())
+		}
+	}
+
+	// Compare after defaults so a partially specified block is still
+	// checked against the values that will actually be used.
+	o = o.WithDefaults()
+	if o.Jitter >= o.Interval {
+		v.add(path+".jitter", "must be less than interval (%s), got %s", o.Interval.D(), o.Jitter.D())
+	}
+	if o.MaxBackoff < o.Interval {
+		v.add(path+".max_backoff", "must be at least interval (%s), got %s", o.Interval.D(), o.MaxBackoff.D())
+	}
+	if o.Zip != "" && !validation.ValidZip(o.Zip) {
+		v.add(path+".zip", "%q is not a valid ZIP code", o.Zip)
+	}
+	if o.State != "" && !validation.ValidState(o.State) {
+		v.add(path+".state", "%q is not a US state code", o.State)
+	}
+}
+
+func (v *validator) retry(path string, c task.RetryConfig) {
+	for _, name := range sortedKeys(c) {
+		p, field := c[name], path+"."+name
+		stage, ok := task.RetryStage(name)
+		if !ok {
+			v.add(field, "unknown stage (want login, add_to_cart, verify_cart, fulfillment, payment, review_totals or place_order)")
+			continue
+		}
+		if p.Attempts < 0 {
+			v.add(field+".attempts", "must not be negative, got %d", p.Attempts)
+		}
+		if p.Backoff < 0 {
+			v.add(field+".backoff", "must not be negative, got %s", p.Backoff.D())
+		}
+		if p.MaxBackoff < 0 {
+			v.add(field+".max_backoff", "must not be negative, got %s", p.MaxBackoff.D())
+		}
+		if p.ReloginEnabled() && !task.CanRelogin(stage) {
+			v.add(field+".relogin", "not supported for %s", name)
+		}
+	}
+}
+
+func (v *validator) budget(path string, l budget.Limits, cfg orchestrator.Config) {
+	if l.Total < 0 {
+		v.add(path+".total", "must not be negative, got %s", l.Total)
+	}
+	for _, name := range sortedKeys(l.Profiles) {
+		field := fmt.Sprintf("%s.profiles[%q]", path, name)
+		if _, ok := cfg.LookupProfile(name); !ok || name == "" {
+			v.add(field, "no profile named %q", name)
+		}
+		if l.Profiles[name] < 0 {
+			v.add(field, "must not be negative, got %s", l.Profiles[name])
+		}
+	}
+	for _, last4 := range sortedKeys(l.Cards) {
+		field := fmt.Sprintf("%s.cards[%q]", path, last4)
+		if len(last4) != 4 || !validation.AllDigits(last4) {
+			v.add(field, "cards are keyed by their last 4 digits, got %q", last4)
+		}
+		if l.Cards[last4] < 0 {
+			v.add(field, "must not be negative, got %s", l.Cards[last4])
+		}
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
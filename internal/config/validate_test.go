@@ -0,0 +1,125 @@
+package config
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"zeng_bot/internal/budget"
+	"zeng_bot/internal/models"
+	"zeng_bot/internal/orchestrator"
+	"zeng_bot/internal/task"
+)
+
+// validProfile returns a profile that passes validation.
+func validProfile(name string) models.Profile {
+	addr := models.Address{Line1: "123 Main St", City: "Minneapolis", State: "MN", ZipCode: "55403", Country: "US"}
+	return models.Profile{
+		Name:     name,
+		Email:    "jane@example.com",
+		Password: "change-me",
+		Phone:    "5555550100",
+		Billing:  addr,
+		Shipping: addr,
+		Payment:  models.Payment{CardNumber: "4111111111111111", ExpMonth: "12", ExpYear: "2099", CVV: "123"},
+	}
+}
+
+// validConfig returns a config with one task that passes validation.
+func validConfig() orchestrator.Config {
+	return orchestrator.Config{
+		WorkerCount: 1,
+		Profiles:    []models.Profile{validProfile("main")},
+		Tasks:       []models.Task{{ID: "t1", Product: models.TargetProduct{TCIN: "89828965", StoreID: "1375"}}},
+	}
+}
+
+// invalidFields returns the fields err reports, or nil if err is nil.
+func invalidFields(t *testing.T, err error) []string {
+	t.Helper()
+	if err == nil {
+		return nil
+	}
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("error %v is not a *ValidationError", err)
+	}
+	fields := make([]string, len(verr.Fields))
+	for i, f := range verr.Fields {
+		fields[i] = f.Field
+	}
+	return fields
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		edit   func(cfg *orchestrator.Config)
+		fields []string
+	}{
+		{"valid", func(cfg *orchestrator.Config) {}, nil},
+		{"no profiles", func(cfg *orchestrator.Config) { cfg.Profiles = nil }, []string{"profiles", "tasks[0].profile"}},
+		{"duplicate profile", func(cfg *orchestrator.Config) {
+			cfg.Profiles = append(cfg.Profiles, validProfile("main"))
+		}, []string{"profiles[1].name"}},
+		{"bad card number", func(cfg *orchestrator.Config) {
+			cfg.Profiles[0].Payment.CardNumber = "4111111111111112"
+		}, []string{"profiles[0].payment.card_number"}},
+		{"Amex with a 3-digit CVV", func(cfg *orchestrator.Config) {
+			cfg.Profiles[0].Payment.CardNumber, cfg.Profiles[0].Payment.CVV = "378282246310005", "123"
+		}, []string{"profiles[0].payment.cvv"}},
+		{"no products or tasks", func(cfg *orchestrator.Config) { cfg.Tasks = nil }, []string{"products"}},
+		{"products and tasks", func(cfg *orchestrator.Config) {
+			cfg.Products = []models.TargetProduct{{TCIN: "1"}}
+		}, []string{"products"}},
+		{"non-numeric TCIN", func(cfg *orchestrator.Config) {
+			cfg.Tasks[0].Product.TCIN = "A-89828965"
+		}, []string{"tasks[0].product.tcin"}},
+		{"non-numeric store", func(cfg *orchestrator.Config) {
+			cfg.Tasks[0].Product.StoreID = "T1375"
+		}, []string{"tasks[0].product.store_id"}},
+		{"pickup without a store", func(cfg *orchestrator.Config) {
+			cfg.Tasks[0].Product.StoreID = ""
+			cfg.Tasks[0].Fulfillment = models.FulfillmentPickup
+		}, []string{"tasks[0].product.store_id"}},
+		{"unknown task profile", func(cfg *orchestrator.Config) {
+			cfg.Tasks[0].Profile = "other"
+		}, []string{"tasks[0].profile"}},
+		{"duplicate task ID", func(cfg *orchestrator.Config) {
+			cfg.Tasks = append(cfg.Tasks, cfg.Tasks[0])
+		}, []string{"tasks[1].id"}},
+		{"bad proxy", func(cfg *orchestrator.Config) {
+			cfg.Proxies = []models.Proxy{{Host: "proxy", Port: "0", Username: "user"}}
+		}, []string{"proxies[0].port", "proxies[0]"}},
+		{"jitter over interval", func(cfg *orchestrator.Config) {
+			cfg.Monitor.Interval = models.Duration(time.Second)
+			cfg.Monitor.Jitter = models.Duration(2 * time.Second)
+		}, []string{"monitor.jitter"}},
+		{"unknown retry stage", func(cfg *orchestrator.Config) {
+			cfg.Retry = task.RetryConfig{"checkout": {Attempts: 2}}
+		}, []string{"retry.checkout"}},
+		{"budget keys", func(cfg *orchestrator.Config) {
+			cfg.Budget = budget.Limits{
+				Profiles: map[string]models.Money{"other": 100},
+				Cards:    map[string]models.Money{"1111": 100, "11a1": 100, "41111": 100},
+			}
+		}, []string{`budget.profiles["other"]`, `budget.cards["11a1"]`, `budget.cards["41111"]`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := validConfig()
+			tt.edit(&cfg)
+			got := invalidFields(t, Validate(cfg))
+			if strings.Join(got, ", ") != strings.Join(tt.fields, ", ") {
+				t.Errorf("invalid fields = %q, want %q", got, tt.fields)
+			}
+		})
+	}
+}
+
+func TestValidateExampleConfig(t *testing.T) {
+	if _, err := Load("../../config.example.yaml"); err != nil {
+		t.Fatalf("config.example.yaml: %v", err)
+	}
+}
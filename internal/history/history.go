@@ -0,0 +1,221 @@
+// Package history persists placed orders to a JSON Lines ledger so past
+// runs can be inspected from the CLI. New orders are appended; status
+// updates rewrite the file in place.
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"zeng_bot/internal/models"
+)
+
+// Record is a single placed order in the ledger.
+type Record struct {
+	Time     time.Time `json:"time"`
+	OrderID  string    `json:"order_id"`
+	CartID   string    `json:"cart_id,omitempty"`
+	Profile  string    `json:"profile"`
+	TCIN     string    `json:"tcin"`
+	DPCI     string    `json:"dpci,omitempty"`
+	Name     string    `json:"name,omitempty"`
+	StoreID  string    `json:"store_id,omitempty"`
+	WorkerID int       `json:"worker_id"`
+	TaskID   string    `json:"task_id,omitempty"`
+	Quantity int       `json:"quantity,omitempty"`
+	// Total is the order's grand total, if Target reported it.
+	Total models.Money `json:"total,omitempty"`
+	// Fulfillment is "ship", "pickup" or "drive_up"; pickup orders
+	// record the store to collect from.
+	Fulfillment     string `json:"fulfillment,omitempty"`
+	PickupStoreID   string `json:"pickup_store_id,omitempty"`
+	PickupStoreName string `json:"pickup_store_name,omitempty"`
+	// Tenders is how the order was paid when it was split across gift
+	// cards and a card.
+	Tenders []models.Tender `json:"tenders,omitempty"`
+
+	// Status is the order's latest known status and StatusHistory every
+	// change seen by the order tracker, oldest first.
+	Status        models.OrderStatus `json:"status,omitempty"`
+	StatusHistory []StatusChange     `json:"status_history,omitempty"`
+	// Cancellation is the latest request to cancel the order, if any.
+	Cancellation *Cancellation `json:"cancellation,omitempty"`
+}
+
+// CancelOutcome is how a cancellation request ended.
+type CancelOutcome string
+
+const (
+	// CancelConfirmed means Target reported the order cancelled.
+	CancelConfirmed CancelOutcome = "cancelled"
+	// CancelRequested means Target accepted the request but the order
+	// was not cancelled yet.
+	CancelRequested CancelOutcome = "requested"
+	// CancelRejected means Target refused to cancel the order.
+	CancelRejected CancelOutcome = "rejected"
+	// CancelFailed means the request failed before Target answered it.
+	CancelFailed CancelOutcome = "failed"
+)
+
+// Cancellation records a request to cancel an order.
+type Cancellation struct {
+	RequestedAt time.Time     `json:"requested_at"`
+	Reason      string        `json:"reason,omitempty"`
+	Outcome     CancelOutcome `json:"outcome"`
+	Error       string        `json:"error,omitempty"`
+}
+
+// Accepted reports whether Target cancelled the order or accepted the
+// request to. It is false for a nil Cancellation.
+func (c *Cancellation) Accepted() bool {
+	return c != nil && (c.Outcome == CancelConfirmed || c.Outcome == CancelRequested)
+}
+
+// StatusChange is one status an order was seen to move to.
+type StatusChange struct {
+	Status models.OrderStatus `json:"status"`
+	At     time.Time          `json:"at"`
+}
+
+// SetStatus records that the order moved to status at t. It does nothing
+// if status is already the latest.
+func (r *Record) SetStatus(status models.OrderStatus, t time.Time) {
+	if r.Status == status {
+		return
+	}
+	r.Status = status
+	r.StatusHistory = append(r.StatusHistory, StatusChange{Status: status, At: t})
+}
+
+// ErrNotFound is returned by Update for an order ID not in the ledger.
+var ErrNotFound = errors.New("order not in ledger")
+
+// Ledger appends records to a JSON Lines file. It is safe for concurrent
+// use by multiple workers.
+type Ledger struct {
+	path string
+	mu   sync.Mutex
+}
+
+// NewLedger returns a Ledger backed by the file at path. The file is
+// created on the first Append.
+func NewLedger(path string) *Ledger {
+	return &Ledger{path: path}
+}
+
+// Path returns the ledger's file path.
+func (l *Ledger) Path() string {
+	return l.path
+}
+
+// Append writes rec as a new line at the end of the ledger.
+func (l *Ledger) Append(rec Record) error {
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("failed to marshal record: %w", err)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open ledger: %w", err)
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write ledger: %w", err)
+	}
+	return f.Close()
+}
+
+// List returns every record in the ledger, oldest first. A missing ledger
+// file is treated as empty.
+func (l *Ledger) List() ([]Record, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.read()
+}
+
+// Update applies fn to the record for orderID and rewrites the ledger.
+// The new file replaces the old one only once it is fully written, so a
+// crash cannot lose earlier records.
+func (l *Ledger) Update(orderID string, fn func(*Record)) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	records, err := l.read()
+	if err != nil {
+		return err
+	}
+	found := false
+	for i := range records {
+		if records[i].OrderID == orderID {
+			fn(&records[i])
+			found = true
+		}
+	}
+	if !found {
+		return fmt.Errorf("%s: %w", orderID, ErrNotFound)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(l.path), filepath.Base(l.path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create ledger: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	w := bufio.NewWriter(tmp)
+	enc := json.NewEncoder(w)
+	for _, rec := range records {
+		if err := enc.Encode(rec); err != nil {
+			tmp.Close()
+			return fmt.Errorf("failed to write ledger: %w", err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write ledger: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write ledger: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), l.path); err != nil {
+		return fmt.Errorf("failed to replace ledger: %w", err)
+	}
+	return nil
+}
+
+// read parses every record in the ledger. The caller holds l.mu.
+func (l *Ledger) read() ([]Record, error) {
+	f, err := os.Open(l.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open ledger: %w", err)
+	}
+	defer f.Close()
+
+	var records []Record
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var rec Record
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return nil, fmt.Errorf("%s line %d: %w", l.path, line, err)
+		}
+		records = append(records, rec)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read ledger: %w", err)
+	}
+	return records, nil
+}
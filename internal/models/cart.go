@@ -0,0 +1,97 @@
+package models
+
+import "fmt"
+
+// Cart is the contents of an account's cart as returned by Target's
+// cart_views API and by every call that changes the cart.
+// Endpoint: GET https://carts.target.com/web_checkouts/v1/cart_views?cart_type=REGULAR&field_groups=...&key=...
+type Cart struct {
+	CartID    string      `json:"cart_id"`
+	CartType  string      `json:"cart_type"`
+	CartItems []CartItem  `json:"cart_items"`
+	Summary   CartSummary `json:"summary"`
+}
+
+// Item returns the cart's line for tcin, if any.
+func (c Cart) Item(tcin string) (CartItem, bool) {
+	for _, item := range c.CartItems {
+		if item.TCIN == tcin {
+			return item, true
+		}
+	}
+	return CartItem{}, false
+}
+
+// CartItem is a single line in a Cart.
+type CartItem struct {
+	CartItemID  string              `json:"cart_item_id"`
+	TCIN        string              `json:"tcin"`
+	Quantity    int                 `json:"quantity"`
+	UnitPrice   Money               `json:"unit_price"`
+	ListPrice   Money               `json:"list_price"`
+	Item        CartItemDetails     `json:"item"`
+	Fulfillment CartItemFulfillment `json:"fulfillment"`
+}
+
+// Title returns the item's product name, or its TCIN if Target sent none.
+func (i CartItem) Title() string {
+	if t := i.Item.ProductDescription.Title; t != "" {
+		return t
+	}
+	return "TCIN " + i.TCIN
+}
+
+// CartItemDetails describes the product on a cart line.
+type CartItemDetails struct {
+	DPCI               string             `json:"dpci"`
+	ProductDescription ProductDescription `json:"product_description"`
+}
+
+// ProductDescription holds a product's display name.
+type ProductDescription struct {
+	Title string `json:"title"`
+}
+
+// CartItemFulfillment is how a cart line will be delivered. Type is
+// "SHIPPING", "PICKUP" or "DRIVE_UP"; LocationID is the store for the
+// last two.
+type CartItemFulfillment struct {
+	Type         string `json:"type"`
+	LocationID   string `json:"location_id,omitempty"`
+	LocationName string `json:"location_name,omitempty"`
+}
+
+// CartSummary holds the totals Target computes for a cart. Tax and
+// shipping are only known once fulfillment is selected.
+type CartSummary struct {
+	ItemsQuantity int   `json:"items_quantity"`
+	ProductTotal  Money `json:"total_product_price"`
+	Discounts     Money `json:"total_discounts"`
+	Shipping      Money `json:"total_shipping_price"`
+	Tax           Money `json:"total_tax"`
+	GrandTotal    Money `json:"grand_total"`
+}
+
+// CartPolicy decides what a worker does with items in the cart that do
+// not belong to its task before checking out.
+type CartPolicy string
+
+const (
+	// CartRemove removes unrelated items so only the task's item is
+	// bought. This is the default.
+	CartRemove CartPolicy = "remove"
+	// CartKeep checks out whatever else is in the cart too.
+	CartKeep CartPolicy = "keep"
+	// CartAbort fails the checkout rather than touch the cart.
+	CartAbort CartPolicy = "abort"
+)
+
+// UnmarshalText rejects unknown policies when decoding config.
+func (p *CartPolicy) UnmarshalText(b []byte) error {
+	switch policy := CartPolicy(b); policy {
+	case "", CartRemove, CartKeep, CartAbort:
+		*p = policy
+		return nil
+	}
+	return fmt.Errorf("unknown cart policy %q (want %q, %q or %q)", b, CartRemove, CartKeep, CartAbort)
+}
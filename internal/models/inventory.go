@@ -0,0 +1,48 @@
+package models
+
+// FulfillmentResponse is the parsed response from Target's redsky
+// product fulfillment aggregation, used to check stock.
+// Endpoint: GET https://redsky.target.com/redsky_aggregations/v1/web/pdp_fulfillment_v1?key=...&tcin=...&store_id=...
+type FulfillmentResponse struct {
+	Data FulfillmentData `json:"data"`
+}
+
+// FulfillmentData wraps the product within a FulfillmentResponse.
+type FulfillmentData struct {
+	Product FulfillmentProduct `json:"product"`
+}
+
+// FulfillmentProduct holds the availability of a single TCIN.
+type FulfillmentProduct struct {
+	TCIN        string             `json:"tcin"`
+	Fulfillment ProductFulfillment `json:"fulfillment"`
+}
+
+// ProductFulfillment lists availability by fulfillment channel.
+type ProductFulfillment struct {
+	ProductID                      string          `json:"product_id"`
+	PurchaseLimit                  int             `json:"purchase_limit"`
+	IsOutOfStockInAllStoreLocation bool            `json:"is_out_of_stock_in_all_store_locations"`
+	ShippingOptions                ShippingOptions `json:"shipping_options"`
+	StoreOptions                   []StoreOption   `json:"store_options"`
+}
+
+// ShippingOptions is the ship-to-home availability of a product.
+type ShippingOptions struct {
+	AvailabilityStatus         string  `json:"availability_status"`
+	AvailableToPromiseQuantity float64 `json:"available_to_promise_quantity"`
+}
+
+// StoreOption is the availability of a product at a single store.
+type StoreOption struct {
+	LocationID                         string             `json:"location_id"`
+	LocationName                       string             `json:"location_name"`
+	LocationAvailableToPromiseQuantity float64            `json:"location_available_to_promise_quantity"`
+	OrderPickup                        FulfillmentChannel `json:"order_pickup"`
+	InStoreOnly                        FulfillmentChannel `json:"in_store_only"`
+}
+
+// FulfillmentChannel is the availability of one store fulfillment method.
+type FulfillmentChannel struct {
+	AvailabilityStatus string `json:"availability_status"`
+}
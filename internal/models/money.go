@@ -0,0 +1,65 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Money is an amount in US cents. Keeping prices as integers avoids
+// float rounding when totals are compared against limits.
+type Money int64
+
+// Dollars converts a dollar amount such as 19.99 to Money, rounding to
+// the nearest cent.
+func Dollars(d float64) Money {
+	return Money(math.Round(d * 100))
+}
+
+// ParseMoney parses "19.99", "$19.99" or "1,299.00".
+func ParseMoney(s string) (Money, error) {
+	clean := strings.NewReplacer("$", "", ",", "", " ", "").Replace(s)
+	d, err := strconv.ParseFloat(clean, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid amount %q", s)
+	}
+	return Dollars(d), nil
+}
+
+// String formats m as "$19.99".
+func (m Money) String() string {
+	sign := ""
+	if m < 0 {
+		sign, m = "-", -m
+	}
+	return fmt.Sprintf("%s$%d.%02d", sign, m/100, m%100)
+}
+
+// MarshalJSON encodes m as a dollar amount, e.g. 19.99.
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(strconv.FormatFloat(float64(m)/100, 'f', 2, 64)), nil
+}
+
+// UnmarshalJSON accepts a dollar amount as a number (19.99) or a string
+// ("$19.99").
+func (m *Money) UnmarshalJSON(b []byte) error {
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	switch v := v.(type) {
+	case float64:
+		*m = Dollars(v)
+	case string:
+		parsed, err := ParseMoney(v)
+		if err != nil {
+			return err
+		}
+		*m = parsed
+	default:
+		return fmt.Errorf("invalid amount %s", string(b))
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package models
+
+import "strings"
+
+// OrderStatus is where a placed order is in Target's fulfillment.
+type OrderStatus string
+
+// Order statuses in the order they normally happen. Delivered, picked up
+// and cancelled are final.
+const (
+	OrderPlaced         OrderStatus = "placed"
+	OrderProcessing     OrderStatus = "processing"
+	OrderShipped        OrderStatus = "shipped"
+	OrderReadyForPickup OrderStatus = "ready_for_pickup"
+	OrderDelivered      OrderStatus = "delivered"
+	OrderPickedUp       OrderStatus = "picked_up"
+	OrderCancelled      OrderStatus = "cancelled"
+)
+
+// OrderUnconfirmed is not a Target status: it marks an order recorded
+// after a checkout error that may have left it placed, until Target
+// reports its status.
+const OrderUnconfirmed OrderStatus = "unconfirmed"
+
+// orderStatusCodes maps the status codes Target's order APIs use, at the
+// order or line level, to an OrderStatus.
+var orderStatusCodes = map[string]OrderStatus{
+	"CREATED":                OrderPlaced,
+	"PLACED":                 OrderPlaced,
+	"ORDER_PLACED":           OrderPlaced,
+	"PROCESSING":             OrderProcessing,
+	"IN_PROCESS":             OrderProcessing,
+	"RELEASED":               OrderProcessing,
+	"PREPARING":              OrderProcessing,
+	"SHIPPED":                OrderShipped,
+	"IN_TRANSIT":             OrderShipped,
+	"OUT_FOR_DELIVERY":       OrderShipped,
+	"READY_FOR_PICKUP":       OrderReadyForPickup,
+	"READY_FOR_STORE_PICKUP": OrderReadyForPickup,
+	"DELIVERED":              OrderDelivered,
+	"PICKED_UP":              OrderPickedUp,
+	"CANCELLED":              OrderCancelled,
+	"CANCELED":               OrderCancelled,
+}
+
+// ParseOrderStatus maps a Target status code to an OrderStatus.
+func ParseOrderStatus(code string) (OrderStatus, bool) {
+	s, ok := orderStatusCodes[strings.ToUpper(strings.TrimSpace(code))]
+	return s, ok
+}
+
+// Final reports whether the order will not change status again.
+func (s OrderStatus) Final() bool {
+	return s == OrderDelivered || s == OrderPickedUp || s == OrderCancelled
+}
+
+// rank orders statuses by progress. Cancelled ranks last so that any
+// line still moving decides an order's status.
+func (s OrderStatus) rank() int {
+	switch s {
+	case OrderPlaced:
+		return 1
+	case OrderProcessing:
+		return 2
+	case OrderShipped, OrderReadyForPickup:
+		return 3
+	case OrderDelivered, OrderPickedUp:
+		return 4
+	case OrderCancelled:
+		return 5
+	}
+	return 0
+}
+
+// OrderDetails is the parsed response from Target's order details API.
+// Endpoint: GET https://api.target.com/guest_order_aggregations/v1/order_history/{order_id}?key=...
+type OrderDetails struct {
+	OrderNumber string      `json:"order_number"`
+	OrderStatus string      `json:"order_status"`
+	OrderLines  []OrderLine `json:"order_lines"`
+}
+
+// OrderLine is a single item in an OrderDetails.
+type OrderLine struct {
+	TCIN     string `json:"tcin"`
+	Quantity int    `json:"quantity"`
+	Status   string `json:"status"`
+}
+
+// Status returns the order's status: the order-level code if Target sent
+// a known one, else the least advanced of its lines, which is cancelled
+// only once every line is.
+func (d OrderDetails) Status() (OrderStatus, bool) {
+	if s, ok := ParseOrderStatus(d.OrderStatus); ok {
+		return s, true
+	}
+	var status OrderStatus
+	for _, line := range d.OrderLines {
+		s, ok := ParseOrderStatus(line.Status)
+		if ok && (status == "" || s.rank() < status.rank()) {
+			status = s
+		}
+	}
+	return status, status != ""
+}
+
+// CancelOrderRequest is the body of Target's order cancellation request.
+// Endpoint: POST https://api.target.com/guest_order_cancellations/v1/orders/{order_id}?key=...
+// The response is the order's OrderDetails after the request.
+type CancelOrderRequest struct {
+	OrderNumber string `json:"order_number"`
+	ReasonCode  string `json:"cancel_reason_code"`
+}
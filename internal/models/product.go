@@ -1,5 +1,7 @@
 package models
 
+import "time"
+
 // TargetProduct represents a product to monitor and purchase on Target.
 type TargetProduct struct {
 	DPCI    string `json:"dpci"`
@@ -8,10 +10,66 @@ type TargetProduct struct {
 	StoreID string `json:"store_id"`
 }
 
+// Availability is the stock state of a product as last seen by the Monitor.
+type Availability int
+
+const (
+	// AvailabilityUnknown means the product has not been polled yet.
+	AvailabilityUnknown Availability = iota
+	// OutOfStock means the last poll found the product unavailable.
+	OutOfStock
+	// InStock means the last poll found the product available to buy.
+	InStock
+)
+
+func (a Availability) String() string {
+	switch a {
+	case OutOfStock:
+		return "Out of Stock"
+	case InStock:
+		return "In Stock"
+	default:
+		return "Unknown"
+	}
+}
+
 // StockEvent is broadcast by the Monitor when a product becomes available.
 // Workers receive this to begin the checkout flow.
 type StockEvent struct {
 	Product    TargetProduct `json:"product"`
 	OfferID    string        `json:"offer_id"`
 	LocationID string        `json:"location_id"`
+
+	// DetectedAt is when the Monitor observed the product in stock.
+	// Workers use it to discard events that sat in the queue too long.
+	DetectedAt time.Time `json:"detected_at"`
+	// PreviousState is the availability before this event: OutOfStock or
+	// AvailabilityUnknown for a restock, InStock for a re-armed event
+	// while the product stayed available.
+	PreviousState Availability `json:"previous_state"`
+
+	// PurchaseLimit is the most units one guest may buy, or 0 if the
+	// Monitor could not tell.
+	PurchaseLimit int `json:"purchase_limit,omitempty"`
+
+	// ShipAvailable and PickupAvailable say which channels the event is
+	// for: the ones that came in stock or were re-armed. Both false means
+	// the source did not say. LocationName is the pickup store's name,
+	// when known.
+	ShipAvailable   bool   `json:"ship_available,omitempty"`
+	PickupAvailable bool   `json:"pickup_available,omitempty"`
+	LocationName    string `json:"location_name,omitempty"`
+}
+
+// AvailableFor reports whether the event's stock can be bought with
+// mode. Events that do not say which channels are in stock are assumed
+// to suit every mode.
+func (e StockEvent) AvailableFor(mode FulfillmentMode) bool {
+	if !e.ShipAvailable && !e.PickupAvailable {
+		return true
+	}
+	if mode.IsPickup() {
+		return e.PickupAvailable
+	}
+	return e.ShipAvailable
 }
@@ -1,17 +1,21 @@
 // Package models defines the core data structures used throughout the bot.
 package models
 
+import "strings"
+
 // Profile represents a user's account credentials, billing and shipping
 // information for checkout. Password is required — Target does not allow
-// guest checkout.
+// guest checkout. GiftCards are applied in order before Payment, which
+// covers whatever they leave.
 type Profile struct {
-	Name     string  `json:"name"`
-	Email    string  `json:"email"`
-	Password string  `json:"password"`
-	Phone    string  `json:"phone"`
-	Billing  Address `json:"billing"`
-	Shipping Address `json:"shipping"`
-	Payment  Payment `json:"payment"`
+	Name      string     `json:"name"`
+	Email     string     `json:"email"`
+	Password  string     `json:"password"`
+	Phone     string     `json:"phone"`
+	Billing   Address    `json:"billing"`
+	Shipping  Address    `json:"shipping"`
+	GiftCards []GiftCard `json:"gift_cards,omitempty"`
+	Payment   Payment    `json:"payment"`
 }
 
 // Address holds a street address used for billing or shipping.
@@ -24,10 +28,123 @@ type Address struct {
 	Country string `json:"country"`
 }
 
-// Payment holds credit card details for checkout submission.
+// Payment holds credit card details for checkout submission. SavedCard
+// picks a card from the account's Target wallet by nickname or last 4
+// digits; when it matches, no card number is sent and the CVV only if
+// Target asks for it. The card fields are then a fallback and may be
+// left empty.
 type Payment struct {
+	SavedCard  string `json:"saved_card,omitempty"`
 	CardNumber string `json:"card_number"`
 	ExpMonth   string `json:"exp_month"`
 	ExpYear    string `json:"exp_year"`
 	CVV        string `json:"cvv"`
 }
+
+// Last4 returns the last four digits of the card number, or of the saved
+// card when it is named by its last 4. It returns an empty string if
+// neither is known.
+func (p Payment) Last4() string {
+	digits := strings.ReplaceAll(p.CardNumber, " ", "")
+	if len(digits) < 4 {
+		if isLast4(p.SavedCard) {
+			return p.SavedCard
+		}
+		return ""
+	}
+	return digits[len(digits)-4:]
+}
+
+// Masked returns the card number with everything but the last four
+// digits hidden, suitable for display and logs. A saved card is shown by
+// the name it is selected with.
+func (p Payment) Masked() string {
+	if p.SavedCard != "" {
+		if isLast4(p.SavedCard) {
+			return "saved **** " + p.SavedCard
+		}
+		return "saved " + p.SavedCard
+	}
+	if last4 := p.Last4(); last4 != "" {
+		return "**** " + last4
+	}
+	return "****"
+}
+
+// HasCard reports whether p names a card, saved or entered.
+func (p Payment) HasCard() bool {
+	return p.SavedCard != "" || p.CardNumber != ""
+}
+
+// GiftCard is a Target gift card, identified by its number and the PIN
+// (access number) printed on the back.
+type GiftCard struct {
+	Number string `json:"number"`
+	PIN    string `json:"pin"`
+}
+
+// Last4 returns the last four digits of the gift card number.
+func (g GiftCard) Last4() string {
+	if len(g.Number) < 4 {
+		return ""
+	}
+	return g.Number[len(g.Number)-4:]
+}
+
+// Masked returns the gift card number with all but the last four digits
+// hidden.
+func (g GiftCard) Masked() string {
+	return "gift card **** " + g.Last4()
+}
+
+// TenderType says how part of an order was paid.
+type TenderType string
+
+const (
+	// TenderGiftCard is one of the profile's gift cards.
+	TenderGiftCard TenderType = "gift_card"
+	// TenderCard is the profile's credit or debit card, entered or saved
+	// in the account's wallet.
+	TenderCard TenderType = "card"
+)
+
+// Tender is one payment applied to an order and the amount it covers.
+type Tender struct {
+	Type   TenderType `json:"type"`
+	Last4  string     `json:"last4,omitempty"`
+	Amount Money      `json:"amount"`
+}
+
+// String formats t as e.g. "gift card 1234 $25.00".
+func (t Tender) String() string {
+	name := "card"
+	if t.Type == TenderGiftCard {
+		name = "gift card"
+	}
+	if t.Last4 != "" {
+		name += " " + t.Last4
+	}
+	return name + " " + t.Amount.String()
+}
+
+// FormatTenders describes how an order was split, e.g.
+// "gift card 1234 $25.00 + card 1111 $34.99".
+func FormatTenders(tenders []Tender) string {
+	parts := make([]string, len(tenders))
+	for i, t := range tenders {
+		parts[i] = t.String()
+	}
+	return strings.Join(parts, " + ")
+}
+
+func isLast4(s string) bool {
+	if len(s) != 4 {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -1,5 +1,10 @@
 package models
 
+import (
+	"strings"
+	"time"
+)
+
 // ATCRequest is the JSON payload for adding an item to the Target cart.
 // Endpoint: POST https://carts.target.com/web_checkouts/v1/cart_items?field_groups=CART,CART_ITEMS,SUMMARY&key=...
 type ATCRequest struct {
@@ -7,6 +12,9 @@ type ATCRequest struct {
 	CartType        string      `json:"cart_type"`
 	ChannelID       string      `json:"channel_id"`
 	ShoppingContext string      `json:"shopping_context"`
+	// Fulfillment picks the store for pickup and drive-up. It is left
+	// out for shipping.
+	Fulfillment *CartItemFulfillment `json:"fulfillment,omitempty"`
 }
 
 // ATCCartItem is the item payload within an ATCRequest.
@@ -16,22 +24,151 @@ type ATCCartItem struct {
 	ItemChannelID string `json:"item_channel_id"`
 }
 
-// ATCResponse is the parsed response from the Target cart API.
-type ATCResponse struct {
-	CartID string `json:"cart_id"`
+// UpdateCartItemRequest is the JSON payload for changing a cart line's
+// quantity.
+// Endpoint: PUT https://carts.target.com/web_checkouts/v1/cart_items/{cart_item_id}?key=...
+type UpdateCartItemRequest struct {
+	CartItem UpdateCartItem `json:"cart_item"`
+	CartType string         `json:"cart_type"`
+}
+
+// UpdateCartItem is the item payload within an UpdateCartItemRequest.
+type UpdateCartItem struct {
+	TCIN        string               `json:"tcin"`
+	Quantity    int                  `json:"quantity"`
+	Fulfillment *CartItemFulfillment `json:"fulfillment,omitempty"`
+}
+
+// CheckoutAddress is an address in the shape the checkout APIs expect.
+type CheckoutAddress struct {
+	FirstName    string `json:"first_name"`
+	LastName     string `json:"last_name"`
+	AddressLine1 string `json:"address_line1"`
+	AddressLine2 string `json:"address_line2,omitempty"`
+	City         string `json:"city"`
+	State        string `json:"state"`
+	ZipCode      string `json:"zip_code"`
+	Country      string `json:"country"`
+	Phone        string `json:"phone,omitempty"`
+}
+
+// NewCheckoutAddress builds a CheckoutAddress for the profile's name and
+// phone at a.
+func NewCheckoutAddress(p Profile, a Address) CheckoutAddress {
+	first, last, _ := strings.Cut(p.Name, " ")
+	return CheckoutAddress{
+		FirstName:    first,
+		LastName:     last,
+		AddressLine1: a.Line1,
+		AddressLine2: a.Line2,
+		City:         a.City,
+		State:        a.State,
+		ZipCode:      a.ZipCode,
+		Country:      a.Country,
+		Phone:        p.Phone,
+	}
+}
+
+// ShippingAddressRequest selects the cart's ship-to address.
+// Endpoint: POST https://carts.target.com/web_checkouts/v1/cart_shipping_addresses?key=...
+type ShippingAddressRequest struct {
+	CartID   string          `json:"cart_id"`
+	CartType string          `json:"cart_type"`
+	Address  CheckoutAddress `json:"address"`
+	Selected bool            `json:"selected"`
+}
+
+// PaymentInstructionRequest attaches a card to the cart. A card from the
+// wallet is sent by WalletID alone with WalletMode "EXISTING"; a card
+// typed in is sent in CardDetails with WalletMode "NONE". Gift cards use
+// PaymentType "GIFT_CARD" and GiftCardDetails, and the cart may hold
+// several before the card that pays the rest.
+// Endpoint: POST https://carts.target.com/checkout_payments/v1/payment_instructions?key=...
+type PaymentInstructionRequest struct {
+	CartID          string           `json:"cart_id"`
+	WalletMode      string           `json:"wallet_mode"`
+	PaymentType     string           `json:"payment_type"`
+	WalletID        string           `json:"wallet_id,omitempty"`
+	CardDetails     *OrderPayment    `json:"card_details,omitempty"`
+	GiftCardDetails *GiftCardDetails `json:"gift_card_details,omitempty"`
+	BillingAddress  *CheckoutAddress `json:"billing_address,omitempty"`
+}
+
+// GiftCardDetails identifies a gift card in a PaymentInstructionRequest
+// or a balance check.
+type GiftCardDetails struct {
+	CardNumber string `json:"card_number"`
+	PIN        string `json:"pin"`
+}
+
+// GiftCardBalance is the response to a gift card balance check.
+// Endpoint: POST https://carts.target.com/checkout_payments/v1/gift_card_balance?key=...
+type GiftCardBalance struct {
+	Balance Money `json:"balance"`
+}
+
+// PaymentInstruction is Target's response to a PaymentInstructionRequest.
+// Amount is what the tender covers and BalanceDue what is left for later
+// tenders. CVVRequired is set when a wallet card must be confirmed with
+// its CVV before the order can be placed.
+type PaymentInstruction struct {
+	PaymentInstructionID string `json:"payment_instruction_id"`
+	Amount               Money  `json:"amount"`
+	BalanceDue           Money  `json:"balance_due"`
+	CVVRequired          bool   `json:"is_cvv_required"`
+}
+
+// CVVChallengeRequest answers a CVV challenge for a wallet card.
+// Endpoint: PUT https://carts.target.com/checkout_payments/v1/payment_instructions/{id}?key=...
+type CVVChallengeRequest struct {
+	CartID      string     `json:"cart_id"`
+	WalletMode  string     `json:"wallet_mode"`
+	PaymentType string     `json:"payment_type"`
+	CardDetails CVVDetails `json:"card_details"`
 }
 
-// OrderRequest is the JSON payload for submitting a Target order.
-type OrderRequest struct {
-	CartID          string       `json:"cart_id"`
-	ChannelID       string       `json:"channel_id"`
-	ShippingAddress Address      `json:"shipping_address"`
-	BillingAddress  Address      `json:"billing_address"`
-	PaymentInfo     OrderPayment `json:"payment_info"`
-	ContactInfo     OrderContact `json:"contact_info"`
+// CVVDetails holds the only card detail sent for a wallet card.
+type CVVDetails struct {
+	CVV string `json:"cvv"`
 }
 
-// OrderPayment holds the payment details within an OrderRequest.
+// Wallet lists the payment methods saved to the account.
+// Endpoint: GET https://api.target.com/guest_wallets/v1/payment_methods?key=...
+type Wallet struct {
+	PaymentMethods []SavedPaymentMethod `json:"payment_methods"`
+}
+
+// SavedPaymentMethod is a card stored in the account's wallet. Target
+// only ever returns its last 4 digits.
+type SavedPaymentMethod struct {
+	WalletID  string `json:"wallet_id"`
+	Nickname  string `json:"card_nickname"`
+	CardType  string `json:"card_type"`
+	Last4     string `json:"last_four_digits"`
+	ExpMonth  string `json:"expiration_month"`
+	ExpYear   string `json:"expiration_year"`
+	IsDefault bool   `json:"is_default"`
+	IsExpired bool   `json:"is_expired"`
+}
+
+// Matches reports whether key names m, either by nickname (ignoring case)
+// or by last 4 digits.
+func (m SavedPaymentMethod) Matches(key string) bool {
+	key = strings.TrimSpace(key)
+	return key != "" && (strings.EqualFold(m.Nickname, key) || m.Last4 == key)
+}
+
+// Find returns the first unexpired card that key names.
+func (w Wallet) Find(key string) (SavedPaymentMethod, bool) {
+	for _, m := range w.PaymentMethods {
+		if m.Matches(key) && !m.IsExpired {
+			return m, true
+		}
+	}
+	return SavedPaymentMethod{}, false
+}
+
+// OrderPayment holds the card details within a PaymentInstructionRequest.
 type OrderPayment struct {
 	CardNumber string `json:"card_number"`
 	ExpMonth   string `json:"exp_month"`
@@ -40,11 +177,11 @@ type OrderPayment struct {
 	CardType   string `json:"card_type"`
 }
 
-// OrderContact holds the contact info within an OrderRequest.
-type OrderContact struct {
-	Name  string `json:"name"`
-	Email string `json:"email"`
-	Phone string `json:"phone"`
+// PlaceOrderRequest is the JSON payload for submitting a Target order.
+// Endpoint: POST https://carts.target.com/web_checkouts/v1/checkout?key=...
+type PlaceOrderRequest struct {
+	CartType  string `json:"cart_type"`
+	ChannelID string `json:"channel_id"`
 }
 
 // OrderResponse is the parsed response from the Target orders API.
@@ -52,6 +189,47 @@ type OrderResponse struct {
 	OrderID string `json:"order_id"`
 }
 
+// OrderHistory is the parsed response from Target's order history API.
+// Endpoint: GET https://api.target.com/guest_order_aggregations/v1/order_history?page_number=1&page_size=10&key=...
+type OrderHistory struct {
+	Orders []OrderHistoryEntry `json:"orders"`
+}
+
+// OrderHistoryEntry is a single order in an OrderHistory, newest first.
+type OrderHistoryEntry struct {
+	OrderNumber string      `json:"order_number"`
+	PlacedDate  time.Time   `json:"placed_date"`
+	OrderLines  []OrderLine `json:"order_lines"`
+}
+
+// Contains reports whether the order has a line for quantity units of
+// tcin. A quantity of 0 matches any.
+func (e OrderHistoryEntry) Contains(tcin string, quantity int) bool {
+	for _, line := range e.OrderLines {
+		if line.TCIN == tcin && (quantity == 0 || line.Quantity == quantity) {
+			return true
+		}
+	}
+	return false
+}
+
+// TargetErrorResponse covers the error body shapes returned by Target's
+// cart, checkout and payment APIs. Any of the fields may be empty.
+type TargetErrorResponse struct {
+	Code      string             `json:"code"`
+	ErrorCode string             `json:"error_code"`
+	Message   string             `json:"message"`
+	Errors    []TargetErrorEntry `json:"errors"`
+	Alerts    []TargetErrorEntry `json:"alerts"`
+}
+
+// TargetErrorEntry is a single entry in a TargetErrorResponse list.
+type TargetErrorEntry struct {
+	Code    string `json:"code"`
+	Reason  string `json:"reason"`
+	Message string `json:"message"`
+}
+
 // DeviceInfo is the full browser fingerprint included in Target auth requests.
 // All fields are string-encoded to match Target's exact wire format.
 type DeviceInfo struct {
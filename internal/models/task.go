@@ -0,0 +1,99 @@
+package models
+
+import "fmt"
+
+// DispatchMode decides how a task's workers share the stock events routed
+// to it.
+type DispatchMode string
+
+const (
+	// DispatchFirstAvailable hands each event to one idle worker of the
+	// task. This is the default.
+	DispatchFirstAvailable DispatchMode = "first_available"
+	// DispatchBroadcast hands each event to every worker of the task, so
+	// all of them attempt a checkout.
+	DispatchBroadcast DispatchMode = "broadcast"
+)
+
+// UnmarshalText rejects unknown modes when decoding config.
+func (m *DispatchMode) UnmarshalText(b []byte) error {
+	switch mode := DispatchMode(b); mode {
+	case "", DispatchFirstAvailable, DispatchBroadcast:
+		*m = mode
+		return nil
+	}
+	return fmt.Errorf("unknown dispatch mode %q (want %q or %q)", b, DispatchFirstAvailable, DispatchBroadcast)
+}
+
+// FulfillmentMode is how a task's order should reach the shopper.
+type FulfillmentMode string
+
+const (
+	// FulfillmentShip ships to the profile's shipping address. This is
+	// the default.
+	FulfillmentShip FulfillmentMode = "ship"
+	// FulfillmentPickup is in-store order pickup at the product's store.
+	FulfillmentPickup FulfillmentMode = "pickup"
+	// FulfillmentDriveUp is curbside pickup at the product's store.
+	FulfillmentDriveUp FulfillmentMode = "drive_up"
+)
+
+// CartType returns the fulfillment type Target uses on cart lines for m.
+func (m FulfillmentMode) CartType() string {
+	switch m {
+	case FulfillmentPickup:
+		return "PICKUP"
+	case FulfillmentDriveUp:
+		return "DRIVE_UP"
+	default:
+		return "SHIPPING"
+	}
+}
+
+// IsPickup reports whether m collects the order at a store.
+func (m FulfillmentMode) IsPickup() bool {
+	return m == FulfillmentPickup || m == FulfillmentDriveUp
+}
+
+// UnmarshalText rejects unknown modes when decoding config.
+func (m *FulfillmentMode) UnmarshalText(b []byte) error {
+	switch mode := FulfillmentMode(b); mode {
+	case "", FulfillmentShip, FulfillmentPickup, FulfillmentDriveUp:
+		*m = mode
+		return nil
+	}
+	return fmt.Errorf("unknown fulfillment mode %q (want %q, %q or %q)", b, FulfillmentShip, FulfillmentPickup, FulfillmentDriveUp)
+}
+
+// Task is one thing to buy: a product, the profile that buys it and how.
+// Workers are created per task and only see stock events for its
+// product.
+type Task struct {
+	// ID names the task in logs, results and order history. Default:
+	// "task-N" by position in the config.
+	ID      string        `json:"id,omitempty"`
+	Product TargetProduct `json:"product"`
+	// Profile is the name of the profile to check out with. Empty means
+	// the first configured profile.
+	Profile  string `json:"profile,omitempty"`
+	Quantity int    `json:"quantity,omitempty"`
+	// MaxPrice is the most the task may pay per unit. Zero means no limit.
+	MaxPrice Money `json:"max_price,omitempty"`
+	// MaxTotal is the most the order may cost including tax and
+	// shipping. Zero means no limit.
+	MaxTotal    Money           `json:"max_total,omitempty"`
+	Fulfillment FulfillmentMode `json:"fulfillment,omitempty"`
+	Workers     int             `json:"workers,omitempty"`
+	Dispatch    DispatchMode    `json:"dispatch,omitempty"`
+	// UnrelatedItems decides what happens to other items already in the
+	// account's cart, apart from those of other tasks on the same
+	// profile. Default: remove.
+	UnrelatedItems CartPolicy `json:"unrelated_items,omitempty"`
+	// Enabled turns the task off without deleting it. Default: true.
+	Enabled *bool `json:"enabled,omitempty"`
+}
+
+// IsEnabled reports whether the task should run.
+func (t Task) IsEnabled() bool {
+	return t.Enabled == nil || *t.Enabled
+}
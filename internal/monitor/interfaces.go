@@ -1,15 +1,20 @@
 // Package monitor is responsible for polling Target's inventory API.
 package monitor
 
-import "zeng_bot/internal/models"
+import (
+	"context"
+
+	"zeng_bot/internal/models"
+)
 
 // Monitor defines the behavior for a stock monitoring service.
 // It polls the inventory API and broadcasts StockEvents to workers.
 type Monitor interface {
 	// Start begins polling for the given products. Stock events are sent
-	// to the returned channel. The caller should cancel the context or
-	// call Stop to shut down polling.
-	Start(products []models.TargetProduct) (<-chan models.StockEvent, error)
+	// to the returned channel, which is closed once polling has stopped.
+	// The caller should cancel the context or call Stop to shut down
+	// polling.
+	Start(ctx context.Context, products []models.TargetProduct) (<-chan models.StockEvent, error)
 
 	// Stop gracefully shuts down the monitor.
 	Stop()
@@ -0,0 +1,394 @@
+package monitor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"zeng_bot/internal/models"
+)
+
+const (
+	redskyAPIKey          = "9f36aeafbe60771e321a7cc95a78140772ab3e96"
+	defaultFulfillmentURL = "https://redsky.target.com/redsky_aggregations/v1/web/pdp_fulfillment_v1"
+)
+
+// errUnexpectedStatus is returned by check for 4xx responses that backoff
+// will not fix, such as a listing that is not live yet. They say nothing
+// about stock, so the tracked state is kept and polling continues at the
+// normal rate.
+var errUnexpectedStatus = errors.New("unexpected status")
+
+// inStockStatuses are the availability_status values that mean the item
+// can be added to cart.
+var inStockStatuses = map[string]bool{
+	"IN_STOCK":           true,
+	"LIMITED_STOCK":      true,
+	"PRE_ORDER_SELLABLE": true,
+}
+
+// Doer sends an HTTP request. session.Session satisfies it, so the monitor
+// can share a TLS-spoofed session; HTTPDoer adapts a plain net/http client
+// for local fake endpoints.
+type Doer interface {
+	Do(ctx context.Context, method, url string, headers map[string]string, body []byte) (statusCode int, respBody []byte, err error)
+}
+
+// HTTPDoer adapts a standard library *http.Client to Doer.
+type HTTPDoer struct {
+	Client *http.Client
+}
+
+// Do executes the request with the wrapped client.
+func (d HTTPDoer) Do(ctx context.Context, method, rawURL string, headers map[string]string, body []byte) (int, []byte, error) {
+	req, err := http.NewRequestWithContext(ctx, method, rawURL, nil)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to build request: %w", err)
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	client := d.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, nil, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return resp.StatusCode, nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+	return resp.StatusCode, respBody, nil
+}
+
+// Options configures a TargetMonitor. Zero values are replaced by the
+// defaults documented on each field.
+type Options struct {
+	// URL is the fulfillment endpoint. Point it at a local server to test
+	// against a fake. Default: Target's redsky pdp_fulfillment_v1.
+	URL string `json:"url,omitempty"`
+	// Interval is the time between polls of one product. Default: 5s.
+	Interval models.Duration `json:"interval,omitempty"`
+	// Jitter randomizes each interval by up to ±Jitter. Default: 1s.
+	Jitter models.Duration `json:"jitter,omitempty"`
+	// HostInterval is the minimum spacing between any two requests to the
+	// same host, across all products. Default: 500ms.
+	HostInterval models.Duration `json:"host_interval,omitempty"`
+	// MaxBackoff caps the exponential backoff after 403, 429 and 5xx
+	// responses or network errors. Default: 2m.
+	MaxBackoff models.Duration `json:"max_backoff,omitempty"`
+	// Debounce is how long a change in availability must persist before
+	// it is acted on. Zero accepts a change on the first poll that sees it.
+	Debounce models.Duration `json:"debounce,omitempty"`
+	// ReArm is the re-arm policy: "out_of_stock" (default) or "interval".
+	ReArm ReArmPolicy `json:"rearm,omitempty"`
+	// ReArmAfter is how often a product that stays in stock is re-emitted
+	// under the "interval" policy. Default: 30s.
+	ReArmAfter models.Duration `json:"rearm_after,omitempty"`
+	// Zip and State locate the shopper for ship-to-home availability.
+	Zip   string `json:"zip,omitempty"`
+	State string `json:"state,omitempty"`
+}
+
+// WithDefaults returns o with every unset field filled in.
+func (o Options) WithDefaults() Options {
+	if o.URL == "" {
+		o.URL = defaultFulfillmentURL
+	}
+	if o.Interval <= 0 {
+		o.Interval = models.Duration(5 * time.Second)
+	}
+	if o.Jitter <= 0 {
+		o.Jitter = models.Duration(time.Second)
+	}
+	if o.HostInterval <= 0 {
+		o.HostInterval = models.Duration(500 * time.Millisecond)
+	}
+	if o.MaxBackoff <= 0 {
+		o.MaxBackoff = models.Duration(2 * time.Minute)
+	}
+	if o.ReArm == "" {
+		o.ReArm = ReArmOnOutOfStock
+	}
+	if o.ReArmAfter <= 0 {
+		o.ReArmAfter = models.Duration(30 * time.Second)
+	}
+	return o
+}
+
+// TargetMonitor is the production Monitor. It runs one poller per product
+// against Target's fulfillment API and emits a StockEvent when shipping
+// or pickup at the product's store goes from out of stock to in stock,
+// not on every poll that finds it available.
+type TargetMonitor struct {
+	doer    Doer
+	opts    Options
+	limiter *hostLimiter
+
+	mu      sync.Mutex
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+	stopped chan struct{}
+}
+
+// NewTargetMonitor creates a monitor that sends requests through doer.
+func NewTargetMonitor(doer Doer, opts Options) *TargetMonitor {
+	opts = opts.WithDefaults()
+	return &TargetMonitor{
+		doer:    doer,
+		opts:    opts,
+		limiter: newHostLimiter(opts.HostInterval.D()),
+	}
+}
+
+// Start launches a poller per product. The returned channel is closed
+// after Stop is called or ctx is cancelled and every poller has exited.
+func (m *TargetMonitor) Start(ctx context.Context, products []models.TargetProduct) (<-chan models.StockEvent, error) {
+	if len(products) == 0 {
+		return nil, fmt.Errorf("no products to monitor")
+	}
+	if _, err := url.Parse(m.opts.URL); err != nil {
+		return nil, fmt.Errorf("invalid monitor URL: %w", err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.cancel != nil {
+		return nil, fmt.Errorf("monitor already started")
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	m.cancel = cancel
+	m.stopped = make(chan struct{})
+
+	events := make(chan models.StockEvent, len(products))
+	for _, p := range products {
+		m.wg.Add(1)
+		go m.poll(ctx, p, events)
+	}
+	go func() {
+		m.wg.Wait()
+		close(events)
+		close(m.stopped)
+	}()
+
+	log.Printf("[monitor] polling %d products every %s (±%s)", len(products), m.opts.Interval.D(), m.opts.Jitter.D())
+	return events, nil
+}
+
+// Stop cancels every poller and waits for them to exit. It is safe to call
+// more than once, and before Start.
+func (m *TargetMonitor) Stop() {
+	m.mu.Lock()
+	cancel, stopped := m.cancel, m.stopped
+	m.mu.Unlock()
+	if cancel == nil {
+		return
+	}
+	cancel()
+	<-stopped
+}
+
+// poll checks product until ctx is cancelled, backing off exponentially
+// while Target rate-limits or errors.
+func (m *TargetMonitor) poll(ctx context.Context, product models.TargetProduct, events chan<- models.StockEvent) {
+	defer m.wg.Done()
+
+	reqURL := m.productURL(product)
+	host := hostOf(reqURL)
+	failures := 0
+	tracker := newProductTracker(product, m.opts)
+
+	for {
+		if err := m.limiter.Wait(ctx, host); err != nil {
+			return
+		}
+
+		event, err := m.check(ctx, reqURL, product)
+		switch {
+		case ctx.Err() != nil:
+			return
+		case errors.Is(err, errUnexpectedStatus):
+			failures = 0
+			log.Printf("[monitor] TCIN %s: %v", product.TCIN, err)
+		case err != nil:
+			// Errors say nothing about stock, so the tracked state is
+			// left as it was.
+			failures++
+			log.Printf("[monitor] TCIN %s: %v (backing off %s)", product.TCIN, err, m.backoff(failures))
+		default:
+			failures = 0
+			now := time.Now()
+			ship, pickup := tracker.observe(now, seen(event.ShipAvailable), seen(event.PickupAvailable))
+			if ship.prev != ship.state {
+				log.Printf("[monitor] TCIN %s ship: %s -> %s", product.TCIN, ship.prev, ship.state)
+			}
+			if pickup.prev != pickup.state {
+				log.Printf("[monitor] TCIN %s pickup at %s: %s -> %s", product.TCIN, product.StoreID, pickup.prev, pickup.state)
+			}
+			if ship.emit || pickup.emit {
+				// Mark only the channels that came in stock, so tasks for
+				// a channel that stayed in stock are not set off again.
+				event.ShipAvailable, event.PickupAvailable = ship.emit, pickup.emit
+				event.DetectedAt = now
+				event.PreviousState = previousState(ship, pickup)
+				log.Printf("[monitor] TCIN %s in stock (ship %t, pickup %t at %s)",
+					product.TCIN, ship.emit, pickup.emit, event.LocationID)
+				select {
+				case events <- event:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+
+		if err := sleepCtx(ctx, m.nextDelay(failures)); err != nil {
+			return
+		}
+	}
+}
+
+// check performs one availability request and returns the event for it,
+// with the channels that are in stock marked. A non-nil error means the
+// poll should be retried with backoff.
+func (m *TargetMonitor) check(ctx context.Context, reqURL string, product models.TargetProduct) (models.StockEvent, error) {
+	headers := models.DefaultHeaders()
+	headers["Accept"] = "application/json"
+	headers["Origin"] = "https://www.target.com"
+	headers["Referer"] = "https://www.target.com/p/-/A-" + product.TCIN
+	headers["Sec-Fetch-Site"] = "same-site"
+
+	status, body, err := m.doer.Do(ctx, "GET", reqURL, headers, nil)
+	if err != nil {
+		return models.StockEvent{}, err
+	}
+	// A 403 is most likely a bot-protection block, which backing off
+	// helps with as much as a rate limit.
+	if status == http.StatusTooManyRequests || status == http.StatusForbidden || status >= 500 {
+		return models.StockEvent{}, fmt.Errorf("status %d", status)
+	}
+	if status < 200 || status >= 300 {
+		return models.StockEvent{}, fmt.Errorf("%w %d", errUnexpectedStatus, status)
+	}
+
+	var resp models.FulfillmentResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return models.StockEvent{}, fmt.Errorf("failed to parse fulfillment response: %w", err)
+	}
+
+	return availability(product, resp.Data.Product.Fulfillment), nil
+}
+
+// availability builds the event for product from fulfillment, marking
+// whether it can be shipped and picked up at the product's StoreID.
+func availability(product models.TargetProduct, f models.ProductFulfillment) models.StockEvent {
+	event := models.StockEvent{
+		Product:    product,
+		OfferID:    f.ProductID,
+		LocationID: product.StoreID,
+
+		PurchaseLimit: f.PurchaseLimit,
+	}
+	if event.OfferID == "" {
+		event.OfferID = product.TCIN
+	}
+
+	event.ShipAvailable = inStockStatuses[f.ShippingOptions.AvailabilityStatus]
+	for _, s := range f.StoreOptions {
+		if s.LocationID == product.StoreID && inStockStatuses[s.OrderPickup.AvailabilityStatus] {
+			event.LocationID, event.LocationName = s.LocationID, s.LocationName
+			event.PickupAvailable = true
+		}
+	}
+	return event
+}
+
+// seen converts a channel's in-stock flag to its Availability.
+func seen(inStock bool) models.Availability {
+	if inStock {
+		return models.InStock
+	}
+	return models.OutOfStock
+}
+
+// previousState is the state an event moved on from. When both channels
+// emit, a restock wins over a re-arm.
+func previousState(ship, pickup channelEdge) models.Availability {
+	switch {
+	case !pickup.emit:
+		return ship.prev
+	case !ship.emit:
+		return pickup.prev
+	}
+	return min(ship.prev, pickup.prev)
+}
+
+func (m *TargetMonitor) productURL(p models.TargetProduct) string {
+	q := url.Values{}
+	q.Set("key", redskyAPIKey)
+	q.Set("tcin", p.TCIN)
+	q.Set("is_bot", "false")
+	if p.StoreID != "" {
+		q.Set("store_id", p.StoreID)
+		q.Set("pricing_store_id", p.StoreID)
+	}
+	if m.opts.Zip != "" {
+		q.Set("zip", m.opts.Zip)
+	}
+	if m.opts.State != "" {
+		q.Set("state", m.opts.State)
+	}
+	return m.opts.URL + "?" + q.Encode()
+}
+
+// nextDelay returns the wait before the next poll: the jittered interval
+// normally, or the backoff after consecutive failures.
+func (m *TargetMonitor) nextDelay(failures int) time.Duration {
+	if failures > 0 {
+		return m.backoff(failures)
+	}
+	d := m.opts.Interval.D()
+	if j := m.opts.Jitter.D(); j > 0 {
+		d += time.Duration(rand.Int63n(int64(2*j))) - j
+	}
+	if d < 0 {
+		d = 0
+	}
+	return d
+}
+
+// backoff doubles the interval per consecutive failure up to MaxBackoff.
+func (m *TargetMonitor) backoff(failures int) time.Duration {
+	d := m.opts.Interval.D()
+	for i := 0; i < failures && d < m.opts.MaxBackoff.D(); i++ {
+		d *= 2
+	}
+	if d > m.opts.MaxBackoff.D() {
+		d = m.opts.MaxBackoff.D()
+	}
+	return d
+}
+
+func hostOf(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	return u.Host
+}
+
+// compile-time check: TargetMonitor must satisfy Monitor.
+var _ Monitor = (*TargetMonitor)(nil)
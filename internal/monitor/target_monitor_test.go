@@ -0,0 +1,328 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"zeng_bot/internal/models"
+)
+
+const (
+	inStock    = "IN_STOCK"
+	outOfStock = "OUT_OF_STOCK"
+)
+
+// channels is a fake entry with separate ship and pickup statuses.
+type channels struct {
+	ship, pickup string
+}
+
+// fakeRedsky serves fulfillment responses from a script, one entry per
+// request; the last entry repeats. An entry is a ship availability
+// status, a channels value or an HTTP error code.
+type fakeRedsky struct {
+	*httptest.Server
+
+	mu     sync.Mutex
+	script []interface{}
+	times  []time.Time
+}
+
+func newFakeRedsky(t *testing.T, script ...interface{}) *fakeRedsky {
+	t.Helper()
+	f := &fakeRedsky{script: script}
+	f.Server = httptest.NewServer(http.HandlerFunc(f.serve))
+	t.Cleanup(f.Close)
+	return f
+}
+
+func (f *fakeRedsky) serve(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	n := len(f.times)
+	f.times = append(f.times, time.Now())
+	entry := f.script[min(n, len(f.script)-1)]
+	f.mu.Unlock()
+
+	if code, ok := entry.(int); ok {
+		w.WriteHeader(code)
+		return
+	}
+	tcin, store := r.URL.Query().Get("tcin"), r.URL.Query().Get("store_id")
+	c, ok := entry.(channels)
+	if !ok {
+		c = channels{ship: entry.(string), pickup: outOfStock}
+	}
+	fmt.Fprintf(w, `{"data":{"product":{"tcin":%q,"fulfillment":{"product_id":%q,"shipping_options":{"availability_status":%q},`+
+		`"store_options":[{"location_id":%q,"location_name":"Test Store","order_pickup":{"availability_status":%q}}]}}}}`,
+		tcin, tcin, c.ship, store, c.pickup)
+}
+
+// requests returns the time of every request served so far.
+func (f *fakeRedsky) requests() []time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]time.Time(nil), f.times...)
+}
+
+// waitForRequests blocks until the fake has served n requests.
+func (f *fakeRedsky) waitForRequests(t *testing.T, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for len(f.requests()) < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("served %d requests, want %d", len(f.requests()), n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// testOptions polls fast with no meaningful jitter or host spacing.
+func testOptions(url string) Options {
+	return Options{
+		URL:          url,
+		Interval:     models.Duration(10 * time.Millisecond),
+		Jitter:       models.Duration(time.Nanosecond),
+		HostInterval: models.Duration(time.Nanosecond),
+		MaxBackoff:   models.Duration(80 * time.Millisecond),
+	}
+}
+
+// startMonitor starts a monitor for one product and stops it when the
+// test ends.
+func startMonitor(t *testing.T, opts Options) (*TargetMonitor, <-chan models.StockEvent) {
+	t.Helper()
+	return startMonitorFor(t, opts, models.TargetProduct{TCIN: "12345678"})
+}
+
+func startMonitorFor(t *testing.T, opts Options, product models.TargetProduct) (*TargetMonitor, <-chan models.StockEvent) {
+	t.Helper()
+	m := NewTargetMonitor(HTTPDoer{}, opts)
+	events, err := m.Start(context.Background(), []models.TargetProduct{product})
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	t.Cleanup(m.Stop)
+	return m, events
+}
+
+// collect stops m once the fake has served n requests and returns every
+// event it emitted.
+func collect(t *testing.T, m *TargetMonitor, f *fakeRedsky, events <-chan models.StockEvent, n int) []models.StockEvent {
+	t.Helper()
+	// Read while polling: the monitor blocks once the channel is full.
+	var got []models.StockEvent
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for e := range events {
+			got = append(got, e)
+		}
+	}()
+	f.waitForRequests(t, n)
+	m.Stop()
+	<-done
+	return got
+}
+
+func TestMonitorEmitsOnceOnRestock(t *testing.T) {
+	f := newFakeRedsky(t, outOfStock, outOfStock, inStock)
+	m, events := startMonitor(t, testOptions(f.URL))
+
+	got := collect(t, m, f, events, 8)
+	if len(got) != 1 {
+		t.Fatalf("got %d events, want 1", len(got))
+	}
+	e := got[0]
+	if e.Product.TCIN != "12345678" || !e.ShipAvailable {
+		t.Errorf("event = %+v, want TCIN 12345678 available to ship", e)
+	}
+	if e.PreviousState != models.OutOfStock {
+		t.Errorf("PreviousState = %s, want %s", e.PreviousState, models.OutOfStock)
+	}
+	if e.DetectedAt.IsZero() {
+		t.Error("DetectedAt is not set")
+	}
+}
+
+func TestMonitorTracksPickupSeparately(t *testing.T) {
+	f := newFakeRedsky(t,
+		channels{inStock, outOfStock},
+		channels{inStock, outOfStock},
+		channels{inStock, inStock},
+		channels{inStock, outOfStock},
+		channels{inStock, inStock})
+	m, events := startMonitorFor(t, testOptions(f.URL), models.TargetProduct{TCIN: "12345678", StoreID: "1234"})
+
+	// Shipping stays in stock throughout, so only the first poll and the
+	// two pickup restocks emit.
+	got := collect(t, m, f, events, 8)
+	if len(got) != 3 {
+		t.Fatalf("got %d events, want 3", len(got))
+	}
+	if e := got[0]; !e.ShipAvailable || e.PickupAvailable {
+		t.Errorf("first event = %+v, want ship only", e)
+	}
+	for _, e := range got[1:] {
+		if e.ShipAvailable || !e.PickupAvailable {
+			t.Errorf("event = %+v, want pickup only", e)
+		}
+		if e.LocationID != "1234" || e.LocationName != "Test Store" {
+			t.Errorf("event location = %q %q, want 1234 Test Store", e.LocationID, e.LocationName)
+		}
+		if e.PreviousState != models.OutOfStock {
+			t.Errorf("PreviousState = %s, want %s", e.PreviousState, models.OutOfStock)
+		}
+		if !e.AvailableFor(models.FulfillmentPickup) || e.AvailableFor(models.FulfillmentShip) {
+			t.Errorf("event = %+v, want it to suit pickup tasks only", e)
+		}
+	}
+}
+
+func TestMonitorBacksOffOnRateLimitAndServerErrors(t *testing.T) {
+	f := newFakeRedsky(t, http.StatusTooManyRequests, http.StatusServiceUnavailable, http.StatusInternalServerError, inStock)
+	m, events := startMonitor(t, testOptions(f.URL))
+
+	got := collect(t, m, f, events, 5)
+	if len(got) != 1 {
+		t.Fatalf("got %d events, want 1", len(got))
+	}
+	times := f.requests()
+	// Backoff doubles the 10ms interval per consecutive failure.
+	for i, want := range []time.Duration{20 * time.Millisecond, 40 * time.Millisecond, 80 * time.Millisecond} {
+		if gap := times[i+1].Sub(times[i]); gap < want {
+			t.Errorf("gap after failure %d = %s, want at least %s", i+1, gap, want)
+		}
+	}
+	if gap := times[4].Sub(times[3]); gap >= 40*time.Millisecond {
+		t.Errorf("gap after a good response = %s, want the normal interval", gap)
+	}
+}
+
+func TestMonitorIgnoresErrorResponsesForStockState(t *testing.T) {
+	for _, code := range []int{http.StatusForbidden, http.StatusNotFound, http.StatusTooManyRequests, http.StatusBadGateway} {
+		t.Run(fmt.Sprint(code), func(t *testing.T) {
+			f := newFakeRedsky(t, inStock, code, code, inStock)
+			m, events := startMonitor(t, testOptions(f.URL))
+
+			// A block or error between two in-stock polls must not look
+			// like a restock.
+			if got := collect(t, m, f, events, 6); len(got) != 1 {
+				t.Fatalf("got %d events, want 1", len(got))
+			}
+		})
+	}
+}
+
+func TestMonitorUnexpectedStatusKeepsNormalRate(t *testing.T) {
+	f := newFakeRedsky(t, http.StatusNotFound)
+	m, events := startMonitor(t, testOptions(f.URL))
+
+	collect(t, m, f, events, 5)
+	times := f.requests()
+	if gap := times[4].Sub(times[3]); gap >= 40*time.Millisecond {
+		t.Errorf("gap after repeated 404s = %s, want the normal interval", gap)
+	}
+}
+
+func TestMonitorDebouncesFlappingStock(t *testing.T) {
+	f := newFakeRedsky(t, outOfStock, inStock, outOfStock, inStock, outOfStock, inStock)
+	opts := testOptions(f.URL)
+	opts.Debounce = models.Duration(35 * time.Millisecond)
+	m, events := startMonitor(t, opts)
+
+	got := collect(t, m, f, events, 12)
+	if len(got) != 1 {
+		t.Fatalf("got %d events, want 1 once stock settled", len(got))
+	}
+	times := f.requests()
+	// The first poll of the final in-stock run is request 5.
+	if settled := times[5].Add(35 * time.Millisecond); got[0].DetectedAt.Before(settled) {
+		t.Errorf("event detected at %s, before the debounce window ended at %s",
+			got[0].DetectedAt.Format(time.StampMicro), settled.Format(time.StampMicro))
+	}
+}
+
+func TestMonitorReArm(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  ReArmPolicy
+		wantMin int
+		wantMax int
+	}{
+		{"out of stock", ReArmOnOutOfStock, 1, 1},
+		{"interval", ReArmAfterInterval, 2, 20},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFakeRedsky(t, inStock)
+			opts := testOptions(f.URL)
+			opts.ReArm = tt.policy
+			opts.ReArmAfter = models.Duration(30 * time.Millisecond)
+			m, events := startMonitor(t, opts)
+
+			got := collect(t, m, f, events, 15)
+			if len(got) < tt.wantMin || len(got) > tt.wantMax {
+				t.Fatalf("got %d events, want %d to %d", len(got), tt.wantMin, tt.wantMax)
+			}
+			for _, e := range got[1:] {
+				if e.PreviousState != models.InStock {
+					t.Errorf("re-armed event PreviousState = %s, want %s", e.PreviousState, models.InStock)
+				}
+			}
+		})
+	}
+}
+
+func TestMonitorStop(t *testing.T) {
+	f := newFakeRedsky(t, outOfStock)
+	m, events := startMonitor(t, testOptions(f.URL))
+	f.waitForRequests(t, 2)
+
+	done := make(chan struct{})
+	go func() {
+		m.Stop()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Stop did not return")
+	}
+	if _, ok := <-events; ok {
+		t.Fatal("event channel still open after Stop")
+	}
+
+	served := len(f.requests())
+	time.Sleep(50 * time.Millisecond)
+	if n := len(f.requests()); n != served {
+		t.Errorf("%d requests after Stop", n-served)
+	}
+	// Stopping again is a no-op.
+	m.Stop()
+}
+
+func TestMonitorStopsWithContext(t *testing.T) {
+	f := newFakeRedsky(t, outOfStock)
+	m := NewTargetMonitor(HTTPDoer{}, testOptions(f.URL))
+	ctx, cancel := context.WithCancel(context.Background())
+	events, err := m.Start(ctx, []models.TargetProduct{{TCIN: "12345678"}})
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	f.waitForRequests(t, 1)
+	cancel()
+
+	select {
+	case _, ok := <-events:
+		if ok {
+			t.Fatal("unexpected event")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("event channel not closed after the context was cancelled")
+	}
+}
@@ -0,0 +1,133 @@
+package monitor
+
+import (
+	"fmt"
+	"time"
+
+	"zeng_bot/internal/models"
+)
+
+// ReArmPolicy decides when a product that stays in stock may produce
+// another StockEvent.
+type ReArmPolicy string
+
+const (
+	// ReArmOnOutOfStock emits again only after the product has gone out
+	// of stock and come back. This is the default.
+	ReArmOnOutOfStock ReArmPolicy = "out_of_stock"
+	// ReArmAfterInterval also re-emits every ReArmAfter while the product
+	// stays in stock, so a drop that every worker missed is retried.
+	ReArmAfterInterval ReArmPolicy = "interval"
+)
+
+// Valid reports whether p is a known policy. The empty policy is valid
+// and means ReArmOnOutOfStock.
+func (p ReArmPolicy) Valid() bool {
+	switch p {
+	case "", ReArmOnOutOfStock, ReArmAfterInterval:
+		return true
+	}
+	return false
+}
+
+// UnmarshalText rejects unknown policies when decoding config.
+func (p *ReArmPolicy) UnmarshalText(b []byte) error {
+	policy := ReArmPolicy(b)
+	if !policy.Valid() {
+		return fmt.Errorf("unknown re-arm policy %q (want %q or %q)", b, ReArmOnOutOfStock, ReArmAfterInterval)
+	}
+	*p = policy
+	return nil
+}
+
+// stockTracker turns a series of availability observations for one
+// product into edge-triggered events. A change in availability must
+// persist for the debounce window before it is accepted, so a listing
+// that flaps between polls does not produce duplicate checkouts.
+type stockTracker struct {
+	debounce   time.Duration
+	policy     ReArmPolicy
+	rearmAfter time.Duration
+
+	state        models.Availability
+	pending      models.Availability
+	pendingSince time.Time
+	lastEmit     time.Time
+}
+
+// observe records the availability seen at now. It reports whether a
+// StockEvent should be emitted and the state it transitioned from.
+func (t *stockTracker) observe(now time.Time, seen models.Availability) (prev models.Availability, emit bool) {
+	if seen == t.state {
+		t.pending = t.state
+		if seen == models.InStock && t.policy == ReArmAfterInterval && now.Sub(t.lastEmit) >= t.rearmAfter {
+			t.lastEmit = now
+			return models.InStock, true
+		}
+		return t.state, false
+	}
+
+	if seen != t.pending {
+		t.pending = seen
+		t.pendingSince = now
+	}
+	if now.Sub(t.pendingSince) < t.debounce {
+		return t.state, false
+	}
+
+	prev, t.state = t.state, seen
+	if seen != models.InStock {
+		return prev, false
+	}
+	t.lastEmit = now
+	return prev, true
+}
+
+// productTracker tracks ship-to-home and pickup at the product's store
+// separately, so a restock on one channel is emitted even while the other
+// stays in stock.
+type productTracker struct {
+	ship   stockTracker
+	pickup *stockTracker // nil when the product has no StoreID
+}
+
+func newProductTracker(product models.TargetProduct, opts Options) *productTracker {
+	newTracker := func() stockTracker {
+		return stockTracker{
+			debounce:   opts.Debounce.D(),
+			policy:     opts.ReArm,
+			rearmAfter: opts.ReArmAfter.D(),
+		}
+	}
+	t := &productTracker{ship: newTracker()}
+	if product.StoreID != "" {
+		pickup := newTracker()
+		t.pickup = &pickup
+	}
+	return t
+}
+
+// channelEdge is the outcome of one observation on one channel.
+type channelEdge struct {
+	prev, state models.Availability
+	emit        bool
+}
+
+// observe records the availability of each channel seen at now and
+// reports the outcome per channel. pickup is ignored without a StoreID.
+func (t *productTracker) observe(now time.Time, ship, pickup models.Availability) (shipEdge, pickupEdge channelEdge) {
+	shipEdge.prev, shipEdge.emit = t.ship.observe(now, ship)
+	shipEdge.state = t.ship.state
+	if t.pickup != nil {
+		pickupEdge.prev, pickupEdge.emit = t.pickup.observe(now, pickup)
+		pickupEdge.state = t.pickup.state
+	}
+	// One event covers both channels, so re-arming counts from it.
+	if shipEdge.emit || pickupEdge.emit {
+		t.ship.lastEmit = now
+		if t.pickup != nil {
+			t.pickup.lastEmit = now
+		}
+	}
+	return shipEdge, pickupEdge
+}
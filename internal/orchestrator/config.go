@@ -0,0 +1,123 @@
+package orchestrator
+
+import (
+	"fmt"
+
+	"zeng_bot/internal/budget"
+	"zeng_bot/internal/models"
+	"zeng_bot/internal/monitor"
+	"zeng_bot/internal/task"
+)
+
+// Config holds the settings for the orchestrator.
+type Config struct {
+	// WorkerCount is the number of workers for tasks that do not set
+	// their own.
+	WorkerCount int `json:"worker_count"`
+	// Profiles are the accounts tasks check out with, referred to by
+	// name. The first one is the default for tasks that name none.
+	Profiles []models.Profile `json:"profiles"`
+	// Products are shorthand for one default task per product. Use
+	// either Products or Tasks.
+	Products []models.TargetProduct `json:"products,omitempty"`
+	Tasks    []models.Task          `json:"tasks,omitempty"`
+	Proxies  []models.Proxy         `json:"proxies"`
+	Monitor  monitor.Options        `json:"monitor,omitempty"`
+
+	// MaxEventAge overrides how old a stock event may be before workers
+	// discard it. Default: task.DefaultMaxEventAge.
+	MaxEventAge models.Duration `json:"max_event_age,omitempty"`
+
+	// Retry overrides the per-stage retry policies from
+	// task.DefaultRetryPolicies.
+	Retry task.RetryConfig `json:"retry,omitempty"`
+
+	// Budget caps what the run may spend in total, per profile and per
+	// card.
+	Budget budget.Limits `json:"budget,omitempty"`
+}
+
+// TaskList returns every task, enabled or not, with defaults filled in.
+// Without explicit tasks, every product becomes a first-available task
+// for the default profile with WorkerCount workers.
+func (c Config) TaskList() []models.Task {
+	tasks := c.Tasks
+	if len(tasks) == 0 {
+		tasks = make([]models.Task, len(c.Products))
+		for i, p := range c.Products {
+			tasks[i] = models.Task{Product: p}
+		}
+	}
+
+	out := make([]models.Task, len(tasks))
+	for i, t := range tasks {
+		if t.ID == "" {
+			t.ID = fmt.Sprintf("task-%d", i+1)
+		}
+		if t.Quantity <= 0 {
+			t.Quantity = 1
+		}
+		if t.Fulfillment == "" {
+			t.Fulfillment = models.FulfillmentShip
+		}
+		if t.Workers <= 0 {
+			t.Workers = max(c.WorkerCount, 1)
+		}
+		if t.Dispatch == "" {
+			t.Dispatch = models.DispatchFirstAvailable
+		}
+		if t.UnrelatedItems == "" {
+			t.UnrelatedItems = models.CartRemove
+		}
+		out[i] = t
+	}
+	return out
+}
+
+// EnabledTasks returns the tasks from TaskList that should run.
+func (c Config) EnabledTasks() []models.Task {
+	var enabled []models.Task
+	for _, t := range c.TaskList() {
+		if t.IsEnabled() {
+			enabled = append(enabled, t)
+		}
+	}
+	return enabled
+}
+
+// DefaultProfile returns the first profile, used by tasks that do not
+// name one.
+func (c Config) DefaultProfile() (models.Profile, bool) {
+	if len(c.Profiles) == 0 {
+		return models.Profile{}, false
+	}
+	return c.Profiles[0], true
+}
+
+// LookupProfile returns the profile called name, or the default profile
+// if name is empty.
+func (c Config) LookupProfile(name string) (models.Profile, bool) {
+	if name == "" {
+		return c.DefaultProfile()
+	}
+	for _, p := range c.Profiles {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return models.Profile{}, false
+}
+
+// WatchList returns every distinct product the enabled tasks need, in
+// task order. This is what the monitor polls.
+func (c Config) WatchList() []models.TargetProduct {
+	seen := make(map[productKey]bool)
+	var products []models.TargetProduct
+	for _, t := range c.EnabledTasks() {
+		if k := keyOf(t.Product); !seen[k] {
+			seen[k] = true
+			products = append(products, t.Product)
+		}
+	}
+	return products
+}
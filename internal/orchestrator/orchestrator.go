@@ -3,55 +3,409 @@
 package orchestrator
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"log"
 	"sync"
+	"sync/atomic"
+	"time"
 
+	"zeng_bot/internal/budget"
 	"zeng_bot/internal/models"
 	"zeng_bot/internal/task"
 )
 
-// Config holds the settings for the orchestrator.
-type Config struct {
-	WorkerCount int              `json:"worker_count"`
-	Profile     models.Profile   `json:"profile"`
-	Products    []models.TargetProduct `json:"products"`
-	Proxies     []models.Proxy   `json:"proxies"`
+// DefaultGracePeriod is how long in-flight checkouts may keep running
+// after shutdown is requested before they are cancelled.
+const DefaultGracePeriod = 30 * time.Second
+
+// Summary counts the outcomes of every checkout attempt in a run and
+// lists the attempts that were cut short by shutdown.
+type Summary struct {
+	Attempts    int
+	Succeeded   int
+	Failed      int
+	Interrupted []task.Result
+	// Partial are successful attempts that bought fewer units than the
+	// task asked for.
+	Partial []task.Result
+	// Spent is the sum of successful orders' totals.
+	Spent models.Money
+
+	// Tasks breaks the counts down per task, in config order.
+	Tasks []TaskSummary
+}
+
+// TaskSummary counts the outcomes of one task's checkout attempts.
+type TaskSummary struct {
+	TaskID      string
+	Attempts    int
+	Succeeded   int
+	Failed      int
+	Interrupted int
+}
+
+// tally accumulates a Summary from concurrent workers.
+type tally struct {
+	mu      sync.Mutex
+	summary Summary
+	index   map[string]int
+}
+
+func newTally(tasks []*taskWorkers) *tally {
+	t := &tally{index: make(map[string]int, len(tasks))}
+	for i, tw := range tasks {
+		t.index[tw.task.ID] = i
+		t.summary.Tasks = append(t.summary.Tasks, TaskSummary{TaskID: tw.task.ID})
+	}
+	return t
+}
+
+// add records one attempt. interrupted means it was cut short by shutdown
+// rather than failing on its own.
+func (t *tally) add(r task.Result, err error, interrupted bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	ts := &t.summary.Tasks[t.index[r.TaskID]]
+	t.summary.Attempts++
+	ts.Attempts++
+	switch {
+	case err == nil:
+		t.summary.Succeeded++
+		ts.Succeeded++
+		t.summary.Spent += r.Totals.GrandTotal
+		if r.Partial() {
+			t.summary.Partial = append(t.summary.Partial, r)
+		}
+	case interrupted:
+		t.summary.Interrupted = append(t.summary.Interrupted, r)
+		ts.Interrupted++
+	default:
+		t.summary.Failed++
+		ts.Failed++
+	}
 }
 
 // Orchestrator coordinates the monitor and worker pool.
 type Orchestrator struct {
-	cfg     Config
+	cfg      Config
+	tasks    []*taskWorkers
+	onResult func(task.Result, error)
+	grace    time.Duration
+	bus      *task.Bus
+	// budget is nil when the config sets no limits.
+	budget *budget.Ledger
+}
+
+// taskWorkers are the workers running one task.
+type taskWorkers struct {
+	task    models.Task
+	profile models.Profile
 	workers []*task.Worker
+	// giftBalance is what the profile's usable gift cards held when the
+	// run started, as far as it could be checked.
+	giftBalance models.Money
+	// stopped is set once a worker hits an error that every later
+	// attempt would repeat, such as a declined card.
+	stopped atomic.Bool
 }
 
 // New creates an Orchestrator with the given config and a client factory.
+// Workers are created for every enabled task with the task's profile;
 // clientFactory is called once per worker to create its CheckoutClient.
-func New(cfg Config, clientFactory func() task.CheckoutClient) *Orchestrator {
-	workers := make([]*task.Worker, cfg.WorkerCount)
-	for i := range workers {
-		workers[i] = task.NewWorker(i, cfg.Profile, clientFactory())
+func New(cfg Config, clientFactory func(models.Profile) task.CheckoutClient) (*Orchestrator, error) {
+	o := &Orchestrator{cfg: cfg, grace: DefaultGracePeriod, bus: task.NewBus()}
+	retry, err := cfg.Retry.Policies()
+	if err != nil {
+		return nil, err
 	}
-	return &Orchestrator{cfg: cfg, workers: workers}
+	if cfg.Budget.Enabled() {
+		o.budget = budget.New(cfg.Budget)
+	}
+	claims := task.NewOrderClaims()
+	id := 0
+	for _, t := range cfg.EnabledTasks() {
+		profile, ok := cfg.LookupProfile(t.Profile)
+		if !ok {
+			return nil, fmt.Errorf("%s: profile %q not found", t.ID, t.Profile)
+		}
+		tw := &taskWorkers{task: t, profile: profile}
+		for n := 0; n < t.Workers; n++ {
+			w := task.NewWorker(id, t, profile, clientFactory(profile))
+			if cfg.MaxEventAge > 0 {
+				w.MaxEventAge = cfg.MaxEventAge.D()
+			}
+			w.Retry = retry
+			w.PublishTo(o.bus)
+			w.Budget = o.budget
+			w.Claims = claims
+			tw.workers = append(tw.workers, w)
+			id++
+		}
+		o.tasks = append(o.tasks, tw)
+	}
+	o.shareCarts()
+	return o, nil
 }
 
-// Run starts workers listening on the stock event channel. It blocks until
-// the channel is closed (monitor stopped) and all workers finish.
-func (o *Orchestrator) Run(events <-chan models.StockEvent) {
-	var wg sync.WaitGroup
+// shareCarts tells each task's workers which products the other tasks on
+// the same profile buy, since those tasks add to the same cart.
+func (o *Orchestrator) shareCarts() {
+	for _, tw := range o.tasks {
+		shared := make(map[string]bool)
+		for _, other := range o.tasks {
+			if other != tw && other.profile.Name == tw.profile.Name {
+				shared[other.task.Product.TCIN] = true
+			}
+		}
+		delete(shared, tw.task.Product.TCIN)
+		if len(shared) == 0 {
+			continue
+		}
+		for _, w := range tw.workers {
+			w.SharedTCINs = shared
+		}
+	}
+}
+
+// OnResult registers fn to be called after every checkout attempt. It is
+// called from worker goroutines and must be safe for concurrent use.
+func (o *Orchestrator) OnResult(fn func(task.Result, error)) {
+	o.onResult = fn
+}
+
+// checkBudget stops every task whose next order could not fit in what is
+// left of the budget. A task's worst case is its max_total, else
+// max_price times quantity; a task with neither is stopped only once
+// nothing is left. The card's limit is held against what the profile's
+// gift cards would leave of the worst case.
+func (o *Orchestrator) checkBudget() {
+	if o.budget == nil {
+		return
+	}
+	for _, tw := range o.tasks {
+		if tw.stopped.Load() {
+			continue
+		}
+		need := tw.task.MaxTotal
+		if need == 0 {
+			need = tw.task.MaxPrice * models.Money(tw.task.Quantity)
+		}
+		remaining, limited := o.budget.Remaining(tw.profile.Name)
+		if limited && (remaining == 0 || need > remaining) && !tw.stopped.Swap(true) {
+			log.Printf("[orchestrator] stopping %s: an order could cost up to %s but only %s of the budget is left",
+				tw.task.ID, need, remaining)
+			continue
+		}
+		card := budget.CardKey(tw.profile.Payment)
+		cardLeft, cardLimited := o.budget.CardRemaining(card)
+		if !cardLimited {
+			continue
+		}
+		cardNeed := max(need-tw.giftBalance, 0)
+		full := cardLeft == 0 && need == 0 && tw.giftBalance == 0
+		if (full || cardNeed > cardLeft) && !tw.stopped.Swap(true) {
+			log.Printf("[orchestrator] stopping %s: the card ending %s could be charged up to %s but only %s of its budget is left",
+				tw.task.ID, card, cardNeed, cardLeft)
+		}
+	}
+}
 
-	for _, w := range o.workers {
-		wg.Add(1)
-		go func(w *task.Worker) {
-			defer wg.Done()
-			for event := range events {
-				if err := w.Run(event); err != nil {
-					log.Printf("[orchestrator] worker %d error: %v", w.ID, err)
+// checkGiftCards looks up every task profile's gift card balances before
+// the drop. Empty and rejected cards are dropped from the workers'
+// profiles so checkout does not try them; a card whose balance cannot be
+// read is kept. A task left with nothing to pay with is stopped.
+func (o *Orchestrator) checkGiftCards(ctx context.Context) {
+	type balance struct {
+		amount models.Money
+		err    error
+	}
+	checked := make(map[string]balance)
+	for _, tw := range o.tasks {
+		if len(tw.profile.GiftCards) == 0 || len(tw.workers) == 0 {
+			continue
+		}
+		checker, ok := tw.workers[0].Client.(task.BalanceChecker)
+		if !ok {
+			continue
+		}
+
+		var usable []models.GiftCard
+		for _, gc := range tw.profile.GiftCards {
+			b, seen := checked[gc.Number]
+			if !seen {
+				b.amount, b.err = checker.GiftCardBalance(ctx, gc)
+				checked[gc.Number] = b
+				if b.err == nil {
+					log.Printf("[orchestrator] %s balance: %s", gc.Masked(), b.amount)
 				}
 			}
-		}(w)
+			switch {
+			case b.err != nil && (errors.Is(b.err, task.ErrPaymentDeclined) || errors.Is(b.err, task.ErrRejected)):
+				log.Printf("[orchestrator] %s: skipping %s: %v", tw.task.ID, gc.Masked(), b.err)
+			case b.err != nil:
+				log.Printf("[orchestrator] %s: could not check %s, keeping it: %v", tw.task.ID, gc.Masked(), b.err)
+				usable = append(usable, gc)
+			case b.amount <= 0:
+				log.Printf("[orchestrator] %s: skipping empty %s", tw.task.ID, gc.Masked())
+			default:
+				usable = append(usable, gc)
+			}
+		}
+
+		tw.giftBalance = 0
+		for _, gc := range usable {
+			tw.giftBalance += checked[gc.Number].amount
+		}
+		tw.profile.GiftCards = usable
+		for _, w := range tw.workers {
+			w.Profile.GiftCards = usable
+		}
+		if len(usable) == 0 && !tw.profile.Payment.HasCard() && !tw.stopped.Swap(true) {
+			log.Printf("[orchestrator] stopping %s: profile %q has no usable gift cards and no card", tw.task.ID, tw.profile.Name)
+		}
 	}
+}
+
+// Subscribe returns a channel of every worker state change, buffered to
+// hold buffer events, and a function to unsubscribe. The channel is
+// closed when Run returns. Subscribe before calling Run to see every
+// change.
+func (o *Orchestrator) Subscribe(buffer int) (<-chan task.StateChange, func()) {
+	return o.bus.Subscribe(buffer)
+}
 
-	log.Printf("[orchestrator] %d workers started, waiting for events...", len(o.workers))
+// SetGracePeriod sets how long in-flight checkouts may run after shutdown
+// is requested. Zero cancels them immediately.
+func (o *Orchestrator) SetGracePeriod(d time.Duration) {
+	o.grace = d
+}
+
+// Run starts every task's workers and routes each event on the stock event
+// channel to the tasks for that product. It blocks until the channel is
+// closed (monitor stopped) or ctx is cancelled and all workers finish,
+// then returns a summary of every attempt.
+//
+// Cancelling ctx requests a graceful shutdown: workers stop taking new
+// events, and checkouts already in flight get the grace period to finish
+// before their contexts are cancelled. Attempts cancelled this way are
+// listed in Summary.Interrupted with the stage they were in.
+func (o *Orchestrator) Run(ctx context.Context, events <-chan models.StockEvent) Summary {
+	// runCtx outlives ctx by the grace period so that a payment already
+	// submitted has a chance to return an order ID.
+	runCtx, cancelRun := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancelRun()
+	go o.drain(ctx, runCtx, cancelRun)
+	// Before any worker starts, so none reads a profile being changed.
+	o.checkGiftCards(ctx)
+
+	var wg sync.WaitGroup
+	results := newTally(o.tasks)
+	rt := newRouter()
+	workers := 0
+	for _, tw := range o.tasks {
+		inboxes := rt.subscribe(tw.task.ID, tw.task.Product, tw.task.Dispatch, len(tw.workers))
+		for i, w := range tw.workers {
+			wg.Add(1)
+			workers++
+			go func(tw *taskWorkers, w *task.Worker, inbox <-chan models.StockEvent) {
+				defer wg.Done()
+				o.work(ctx, runCtx, tw, w, inbox, results)
+			}(tw, w, inboxes[i])
+		}
+	}
+	go func() {
+		defer rt.close()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event, ok := <-events:
+				if !ok {
+					return
+				}
+				rt.dispatch(event)
+			}
+		}
+	}()
+
+	o.checkBudget()
+	log.Printf("[orchestrator] %d tasks, %d workers started, waiting for events...", len(o.tasks), workers)
 	wg.Wait()
-	log.Println("[orchestrator] all workers finished")
+	o.bus.Close()
+	summary := results.summary
+	log.Printf("[orchestrator] all workers finished: %d attempts, %d succeeded, %d failed, %d interrupted",
+		summary.Attempts, summary.Succeeded, summary.Failed, len(summary.Interrupted))
+	for _, r := range summary.Interrupted {
+		log.Printf("[orchestrator] interrupted: %s worker %d, TCIN %s, in state %s", r.TaskID, r.WorkerID, r.Product.TCIN, r.Stage)
+	}
+	return summary
+}
+
+// work runs checkouts for the events in w's inbox until it is closed or
+// shutdown is requested on ctx.
+func (o *Orchestrator) work(ctx, runCtx context.Context, tw *taskWorkers, w *task.Worker, inbox <-chan models.StockEvent, results *tally) {
+	for {
+		var event models.StockEvent
+		select {
+		case <-ctx.Done():
+			return
+		case e, ok := <-inbox:
+			if !ok {
+				return
+			}
+			event = e
+		}
+		// Both cases may be ready at once; never start a new
+		// checkout after shutdown was requested.
+		if ctx.Err() != nil {
+			return
+		}
+		if tw.stopped.Load() {
+			log.Printf("[orchestrator] %s is stopped, ignoring restock of TCIN %s", tw.task.ID, event.Product.TCIN)
+			continue
+		}
+
+		result, err := w.Run(runCtx, event)
+		if errors.Is(err, task.ErrStaleEvent) || errors.Is(err, task.ErrUnavailable) {
+			log.Printf("[orchestrator] discarded: %v", err)
+			continue
+		}
+		if err != nil {
+			log.Printf("[orchestrator] %v", err)
+		}
+		if task.Fatal(err) && !tw.stopped.Swap(true) {
+			log.Printf("[orchestrator] stopping %s: %v", tw.task.ID, err)
+		}
+		if err == nil {
+			o.checkBudget()
+		}
+		results.add(result, err, errors.Is(err, context.Canceled) && runCtx.Err() != nil)
+
+		if o.onResult != nil {
+			o.onResult(result, err)
+		}
+	}
+}
+
+// drain waits for shutdown to be requested on ctx, then cancels runCtx
+// once the grace period expires. It returns early if runCtx ends first,
+// i.e. Run returned because all workers finished.
+func (o *Orchestrator) drain(ctx, runCtx context.Context, cancelRun context.CancelFunc) {
+	select {
+	case <-runCtx.Done():
+		return
+	case <-ctx.Done():
+	}
+
+	log.Printf("[orchestrator] shutdown requested, no new events accepted; draining in-flight checkouts for up to %s", o.grace)
+	timer := time.NewTimer(o.grace)
+	defer timer.Stop()
+	select {
+	case <-runCtx.Done():
+	case <-timer.C:
+		log.Println("[orchestrator] grace period expired, cancelling in-flight checkouts")
+		cancelRun()
+	}
 }
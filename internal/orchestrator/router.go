@@ -0,0 +1,98 @@
+package orchestrator
+
+import (
+	"log"
+
+	"zeng_bot/internal/models"
+)
+
+// productKey identifies a monitored product. Tasks and events are matched
+// on both TCIN and store so pickup tasks only see their own store.
+type productKey struct {
+	TCIN    string
+	StoreID string
+}
+
+func keyOf(p models.TargetProduct) productKey {
+	return productKey{TCIN: p.TCIN, StoreID: p.StoreID}
+}
+
+// route delivers events to one task's workers. First-available tasks
+// share a single inbox; broadcast tasks have one inbox per worker.
+type route struct {
+	name     string
+	workers  int
+	dispatch models.DispatchMode
+	inboxes  []chan models.StockEvent
+}
+
+// router fans stock events out to the tasks subscribed to each product.
+// Sends never block: a worker that is still busy with an earlier event
+// misses the new one rather than stalling delivery to other tasks.
+type router struct {
+	routes map[productKey][]*route
+}
+
+func newRouter() *router {
+	return &router{routes: make(map[productKey][]*route)}
+}
+
+// subscribe registers a task for product and returns the inbox each of
+// its workers should read from.
+func (r *router) subscribe(name string, product models.TargetProduct, dispatch models.DispatchMode, workers int) []<-chan models.StockEvent {
+	rt := &route{name: name, workers: workers, dispatch: dispatch}
+	out := make([]<-chan models.StockEvent, workers)
+	if dispatch == models.DispatchBroadcast {
+		for i := range out {
+			ch := make(chan models.StockEvent, 1)
+			rt.inboxes = append(rt.inboxes, ch)
+			out[i] = ch
+		}
+	} else {
+		ch := make(chan models.StockEvent, 1)
+		rt.inboxes = append(rt.inboxes, ch)
+		for i := range out {
+			out[i] = ch
+		}
+	}
+	key := keyOf(product)
+	r.routes[key] = append(r.routes[key], rt)
+	return out
+}
+
+// dispatch delivers event to every subscribed task.
+func (r *router) dispatch(event models.StockEvent) {
+	routes := r.routes[keyOf(event.Product)]
+	if len(routes) == 0 {
+		log.Printf("[router] no task for TCIN %s at store %q, event dropped", event.Product.TCIN, event.Product.StoreID)
+		return
+	}
+	for _, rt := range routes {
+		delivered := 0
+		for _, inbox := range rt.inboxes {
+			select {
+			case inbox <- event:
+				delivered++
+			default:
+			}
+		}
+		switch {
+		case delivered == len(rt.inboxes):
+		case rt.dispatch == models.DispatchBroadcast:
+			log.Printf("[router] %s: %d of %d workers busy, they skip this event", rt.name, len(rt.inboxes)-delivered, rt.workers)
+		default:
+			log.Printf("[router] %s: all %d workers busy, event dropped", rt.name, rt.workers)
+		}
+	}
+}
+
+// close closes every inbox so workers exit once they drain them.
+func (r *router) close() {
+	for _, routes := range r.routes {
+		for _, rt := range routes {
+			for _, inbox := range rt.inboxes {
+				close(inbox)
+			}
+		}
+	}
+}
@@ -0,0 +1,172 @@
+// Package orders follows placed orders after checkout, polling Target's
+// order details until each reaches a final status.
+package orders
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"zeng_bot/internal/models"
+	"zeng_bot/internal/task"
+)
+
+// Options configures a Tracker. Zero values are replaced by the defaults
+// documented on each field.
+type Options struct {
+	// Interval is the time between polls of one order. Default: 1m.
+	Interval time.Duration
+	// Timeout is how long an order is followed before the tracker gives
+	// up on it. Default: 30m.
+	Timeout time.Duration
+	// MaxBackoff caps the backoff after failed polls. Default: 10m.
+	MaxBackoff time.Duration
+}
+
+// WithDefaults returns o with every unset field filled in.
+func (o Options) WithDefaults() Options {
+	if o.Interval <= 0 {
+		o.Interval = time.Minute
+	}
+	if o.Timeout <= 0 {
+		o.Timeout = 30 * time.Minute
+	}
+	if o.MaxBackoff <= 0 {
+		o.MaxBackoff = 10 * time.Minute
+	}
+	return o
+}
+
+// Order is an order being tracked. Status is its last known status, empty
+// if it has never been polled. CancelRequested is set for orders we asked
+// Target to cancel, so their cancellation is not reported as Target's.
+type Order struct {
+	ID              string
+	Profile         string
+	TaskID          string
+	TCIN            string
+	Status          models.OrderStatus
+	CancelRequested bool
+}
+
+// Update reports that an order moved from one status to another. From is
+// empty on the first poll of an order with no known status.
+type Update struct {
+	Order Order
+	From  models.OrderStatus
+	To    models.OrderStatus
+	At    time.Time
+}
+
+// CancelledAfterPlacement reports whether Target cancelled an order it had
+// accepted without being asked to.
+func (u Update) CancelledAfterPlacement() bool {
+	return u.To == models.OrderCancelled && u.From != models.OrderCancelled && !u.Order.CancelRequested
+}
+
+// Tracker polls the status of every order passed to Track on its own
+// goroutine.
+type Tracker struct {
+	opts     Options
+	onUpdate func(Update)
+
+	wg        sync.WaitGroup
+	mu        sync.Mutex
+	cancelled []Order
+}
+
+// NewTracker creates a Tracker with opts.
+func NewTracker(opts Options) *Tracker {
+	return &Tracker{opts: opts.WithDefaults()}
+}
+
+// OnUpdate registers fn to be called on every status change. It is called
+// from tracking goroutines and must be safe for concurrent use. Register
+// it before the first Track.
+func (t *Tracker) OnUpdate(fn func(Update)) {
+	t.onUpdate = fn
+}
+
+// Track starts polling order through src until it reaches a final
+// status, the timeout passes or ctx is cancelled.
+func (t *Tracker) Track(ctx context.Context, order Order, src task.StatusChecker) {
+	t.wg.Add(1)
+	go func() {
+		defer t.wg.Done()
+		t.follow(ctx, order, src)
+	}()
+}
+
+// Wait blocks until every tracked order has stopped being polled.
+func (t *Tracker) Wait() {
+	t.wg.Wait()
+}
+
+// Cancelled returns the orders Target cancelled after placement, in the
+// order they were seen.
+func (t *Tracker) Cancelled() []Order {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]Order(nil), t.cancelled...)
+}
+
+// follow polls one order. The first poll is immediate; failed polls back
+// off from Interval up to MaxBackoff.
+func (t *Tracker) follow(ctx context.Context, order Order, src task.StatusChecker) {
+	deadline := time.Now().Add(t.opts.Timeout)
+	delay := t.opts.Interval
+	for {
+		status, err := src.OrderStatus(ctx, order.ID)
+		switch {
+		case ctx.Err() != nil:
+			return
+		case err != nil:
+			log.Printf("[tracker] order %s: %v", order.ID, err)
+			if task.Transient(err) || errors.Is(err, task.ErrBlocked) {
+				delay = min(delay*2, t.opts.MaxBackoff)
+			}
+		default:
+			delay = t.opts.Interval
+			if status != order.Status {
+				t.update(Update{Order: order, From: order.Status, To: status, At: time.Now()})
+				order.Status = status
+			}
+			if status.Final() {
+				return
+			}
+		}
+
+		if time.Now().Add(delay).After(deadline) {
+			log.Printf("[tracker] order %s: giving up after %s, last status %q", order.ID, t.opts.Timeout, order.Status)
+			return
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+func (t *Tracker) update(u Update) {
+	if u.From == "" {
+		log.Printf("[tracker] order %s: %s", u.Order.ID, u.To)
+	} else {
+		log.Printf("[tracker] order %s: %s -> %s", u.Order.ID, u.From, u.To)
+	}
+	if u.CancelledAfterPlacement() {
+		log.Printf("[tracker] order %s (%s, TCIN %s) was cancelled by Target", u.Order.ID, u.Order.TaskID, u.Order.TCIN)
+		t.mu.Lock()
+		o := u.Order
+		o.Status = u.To
+		t.cancelled = append(t.cancelled, o)
+		t.mu.Unlock()
+	}
+	if t.onUpdate != nil {
+		t.onUpdate(u)
+	}
+}
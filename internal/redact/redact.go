@@ -0,0 +1,109 @@
+// Package redact masks PII, payment data and credentials in log output.
+// Every log line is routed through a Writer so that request and response
+// bodies can be logged freely without leaking card numbers or tokens.
+package redact
+
+import (
+	"io"
+	"regexp"
+	"strings"
+	"sync/atomic"
+
+	"zeng_bot/internal/validation"
+)
+
+// Mask is the replacement for values that are hidden entirely.
+const Mask = "[REDACTED]"
+
+// sensitiveKeys are JSON keys (matched case-insensitively) whose values
+// are always masked, regardless of what the value looks like.
+var sensitiveKeys = []string{
+	"password", "cvv", "cvc", "security_code", "pin",
+	"card_number", "cardNumber", "account_number",
+	"email", "username", "phone", "phone_number",
+	"line1", "line2", "address_line1", "address_line2", "street",
+	"first_name", "last_name",
+	"access_token", "refresh_token", "id_token", "accessToken", "refreshToken", "idToken",
+}
+
+// sensitiveCookies are cookie names whose values carry session or auth
+// state.
+var sensitiveCookies = []string{
+	"accessToken", "refreshToken", "idToken", "login-session",
+	"_px3", "_pxvid", "_pxhd", "TealeafAkaSid",
+}
+
+var (
+	jsonKeyPattern = regexp.MustCompile(`(?i)("(?:` + alternation(sensitiveKeys) + `)"\s*:\s*)("(?:[^"\\]|\\.)*"|-?\d+(?:\.\d+)?)`)
+	cookiePattern  = regexp.MustCompile(`((?:` + alternation(sensitiveCookies) + `)=)[^;,\s"]+`)
+	bearerPattern  = regexp.MustCompile(`(?i)(bearer\s+)[A-Za-z0-9\-._~+/]+=*`)
+	cookieHeader   = regexp.MustCompile(`(?i)((?:set-)?cookie"?\s*[:=]\s*"?)[^"\n]+`)
+	cardPattern    = regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`)
+	emailPattern   = regexp.MustCompile(`\b([A-Za-z0-9])[A-Za-z0-9._%+-]*(@[A-Za-z0-9.-]+\.[A-Za-z]{2,})\b`)
+	phonePattern   = regexp.MustCompile(`(?:\+?1[-. ]?)?\(?\b\d{3}\)?[-. ]\d{3}[-. ]\d{4}\b`)
+	streetPattern  = regexp.MustCompile(`(?i)\b\d{1,6}\s+(?:[A-Za-z0-9.]+\s+){0,4}(?:st|street|ave|avenue|rd|road|blvd|boulevard|dr|drive|ln|lane|way|ct|court|pl|place|pkwy|parkway|hwy|highway|cir|circle|ter|terrace)\b\.?`)
+)
+
+func alternation(words []string) string {
+	quoted := make([]string, len(words))
+	for i, w := range words {
+		quoted[i] = regexp.QuoteMeta(w)
+	}
+	return strings.Join(quoted, "|")
+}
+
+// String returns s with every sensitive value masked. JSON keys are
+// handled first so structured bodies keep their shape; free-text patterns
+// then catch values outside known keys.
+func String(s string) string {
+	s = jsonKeyPattern.ReplaceAllString(s, `${1}"`+Mask+`"`)
+	s = bearerPattern.ReplaceAllString(s, "${1}"+Mask)
+	s = cookieHeader.ReplaceAllString(s, "${1}"+Mask)
+	s = cookiePattern.ReplaceAllString(s, "${1}"+Mask)
+	s = cardPattern.ReplaceAllStringFunc(s, maskCard)
+	s = emailPattern.ReplaceAllString(s, "${1}***${2}")
+	s = phonePattern.ReplaceAllString(s, "[PHONE]")
+	s = streetPattern.ReplaceAllString(s, "[ADDRESS]")
+	return s
+}
+
+// maskCard replaces a digit run with its last four digits if it passes
+// the Luhn check. Other long numbers (order IDs, TCINs) are left alone.
+func maskCard(match string) string {
+	digits := validation.CardDigits(match)
+	if len(digits) < 13 || !validation.Luhn(digits) {
+		return match
+	}
+	return "[CARD ****" + digits[len(digits)-4:] + "]"
+}
+
+// Writer redacts everything written to it before passing it on. The log
+// package issues one Write per line, so each line is redacted whole.
+type Writer struct {
+	w        io.Writer
+	disabled atomic.Bool
+}
+
+// NewWriter returns a redacting Writer wrapping w. Redaction is enabled
+// until SetEnabled(false) is called.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w}
+}
+
+// SetEnabled turns redaction on or off. Turning it off is meant only for
+// local debugging and must be requested explicitly.
+func (w *Writer) SetEnabled(enabled bool) {
+	w.disabled.Store(!enabled)
+}
+
+// Write redacts p and writes it to the underlying writer. It reports
+// len(p) on success so callers see the bytes they wrote as consumed.
+func (w *Writer) Write(p []byte) (int, error) {
+	if w.disabled.Load() {
+		return w.w.Write(p)
+	}
+	if _, err := io.WriteString(w.w, String(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -1,6 +1,7 @@
 package session
 
 import (
+	"context"
 	"fmt"
 	"log"
 	stdhttp "net/http"
@@ -29,21 +30,26 @@ type BrowserLoginResult struct {
 //  3. Select "password" auth factor (vs passkey)
 //  4. Enter password → submit
 //
+// Cancelling ctx aborts the login at the next step and kills the browser.
+//
 // Set HEADLESS=1 to run without a visible browser window.
-func BrowserLogin(email, password string) (*BrowserLoginResult, error) {
+func BrowserLogin(ctx context.Context, email, password string) (*BrowserLoginResult, error) {
 	headless := os.Getenv("HEADLESS") == "1"
 
-	l := launcher.New().Headless(headless)
+	l := launcher.New().Context(ctx).Headless(headless)
 	controlURL, err := l.Launch()
 	if err != nil {
 		return nil, fmt.Errorf("failed to launch browser: %w", err)
 	}
+	// Kill guarantees the browser process exits even if ctx was cancelled
+	// and the CDP close below could not be delivered.
+	defer l.Kill()
 
-	browser := rod.New().ControlURL(controlURL)
+	browser := rod.New().Context(ctx).ControlURL(controlURL)
 	if err := browser.Connect(); err != nil {
 		return nil, fmt.Errorf("failed to connect to browser: %w", err)
 	}
-	defer browser.MustClose()
+	defer browser.Close()
 
 	page, err := browser.Page(proto.TargetCreateTarget{URL: "https://www.target.com/login"})
 	if err != nil {
@@ -51,7 +57,9 @@ func BrowserLogin(email, password string) (*BrowserLoginResult, error) {
 	}
 
 	// Wait for initial page load.
-	time.Sleep(5 * time.Second)
+	if err := sleepCtx(ctx, 5*time.Second); err != nil {
+		return nil, err
+	}
 	log.Println("[browser-login] login page loaded")
 
 	// Step 1: Click "Sign in or create account" to open the login modal.
@@ -63,32 +71,46 @@ func BrowserLogin(email, password string) (*BrowserLoginResult, error) {
 	if err != nil {
 		return nil, fmt.Errorf("sign-in trigger button not found: %w", err)
 	}
-	signinTrigger.MustClick()
+	if err := signinTrigger.Click(proto.InputMouseButtonLeft, 1); err != nil {
+		return nil, fmt.Errorf("failed to click sign-in trigger: %w", err)
+	}
 	log.Println("[browser-login] opened sign-in modal")
-	time.Sleep(2 * time.Second)
+	if err := sleepCtx(ctx, 2*time.Second); err != nil {
+		return nil, err
+	}
 
 	// Step 2: Fill email and click "Continue".
 	emailEl, err := findElement(page, []string{"#username", `input[name="username"]`}, 10*time.Second)
 	if err != nil {
 		return nil, fmt.Errorf("email field not found: %w", err)
 	}
-	emailEl.MustInput(email)
+	if err := emailEl.Input(email); err != nil {
+		return nil, fmt.Errorf("failed to fill email: %w", err)
+	}
 	log.Println("[browser-login] filled email")
 
 	continueBtn, err := findElement(page, []string{"#login", `button[type="submit"]`}, 5*time.Second)
 	if err != nil {
 		return nil, fmt.Errorf("continue button not found: %w", err)
 	}
-	continueBtn.MustClick()
+	if err := continueBtn.Click(proto.InputMouseButtonLeft, 1); err != nil {
+		return nil, fmt.Errorf("failed to click continue: %w", err)
+	}
 	log.Println("[browser-login] clicked continue")
-	time.Sleep(3 * time.Second)
+	if err := sleepCtx(ctx, 3*time.Second); err != nil {
+		return nil, err
+	}
 
 	// Step 3: Select the "password" auth factor radio if it appears.
 	// (Target may offer passkey vs password choice for existing accounts.)
 	if pwRadio, err := page.Timeout(3 * time.Second).Element(`#password-checkbox`); err == nil {
-		pwRadio.MustClick()
+		if err := pwRadio.Click(proto.InputMouseButtonLeft, 1); err != nil {
+			return nil, fmt.Errorf("failed to select password auth factor: %w", err)
+		}
 		log.Println("[browser-login] selected password auth factor")
-		time.Sleep(2 * time.Second)
+		if err := sleepCtx(ctx, 2*time.Second); err != nil {
+			return nil, err
+		}
 	}
 
 	// Step 4: Fill the password field and submit.
@@ -100,7 +122,9 @@ func BrowserLogin(email, password string) (*BrowserLoginResult, error) {
 	if err != nil {
 		return nil, fmt.Errorf("password field not found: %w", err)
 	}
-	passEl.MustInput(password)
+	if err := passEl.Input(password); err != nil {
+		return nil, fmt.Errorf("failed to fill password: %w", err)
+	}
 	log.Println("[browser-login] filled password")
 
 	submitBtn, err := findElement(page, []string{
@@ -111,11 +135,15 @@ func BrowserLogin(email, password string) (*BrowserLoginResult, error) {
 	if err != nil {
 		return nil, fmt.Errorf("submit button not found: %w", err)
 	}
-	submitBtn.MustClick()
+	if err := submitBtn.Click(proto.InputMouseButtonLeft, 1); err != nil {
+		return nil, fmt.Errorf("failed to submit login form: %w", err)
+	}
 	log.Println("[browser-login] submitted login form")
 
 	// Wait for post-login navigation to settle.
-	time.Sleep(5 * time.Second)
+	if err := sleepCtx(ctx, 5*time.Second); err != nil {
+		return nil, err
+	}
 
 	// Best-effort: dismiss phone verification modal.
 	handlePhoneVerification(page)
@@ -149,6 +177,18 @@ func BrowserLogin(email, password string) (*BrowserLoginResult, error) {
 	}, nil
 }
 
+// sleepCtx waits for d or until ctx is cancelled, whichever comes first.
+func sleepCtx(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
 // findElement tries multiple CSS selectors in order, returning the first
 // element found within the timeout.
 func findElement(page *rod.Page, selectors []string, timeout time.Duration) (*rod.Element, error) {
@@ -172,7 +212,9 @@ func handlePhoneVerification(page *rod.Page) {
 	if err != nil {
 		return // No modal appeared, that's fine.
 	}
-	el.MustClick()
+	if err := el.Click(proto.InputMouseButtonLeft, 1); err != nil {
+		return
+	}
 	log.Println("[browser-login] dismissed phone verification modal")
 }
 
@@ -0,0 +1,129 @@
+package session
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	fhttp "github.com/bogdanfinn/fhttp"
+)
+
+// ErrNoSavedSession is returned by Store.Load when the profile has no
+// saved session.
+var ErrNoSavedSession = errors.New("no saved session")
+
+// Snapshot is the state of a logged-in TargetSession: its cookies and the
+// IDs Target ties them to. Restoring it skips the browser login until the
+// tokens expire.
+type Snapshot struct {
+	SavedAt   time.Time         `json:"saved_at"`
+	VisitorID string            `json:"visitor_id,omitempty"`
+	DeviceID  string            `json:"device_id"`
+	Cookies   map[string]string `json:"cookies"`
+}
+
+// Snapshot captures the session's cookies and IDs.
+func (s *TargetSession) Snapshot() Snapshot {
+	snap := Snapshot{
+		SavedAt:   time.Now(),
+		VisitorID: s.VisitorID,
+		DeviceID:  s.deviceID,
+		Cookies:   make(map[string]string),
+	}
+	for _, rawURL := range cookieInjectionURLs {
+		u, err := url.Parse(rawURL)
+		if err != nil {
+			continue
+		}
+		for _, c := range s.client.GetCookies(u) {
+			snap.Cookies[c.Name] = c.Value
+		}
+	}
+	return snap
+}
+
+// Restore loads a snapshot's cookies and IDs into the session. The jar
+// does not report cookie domains, so every cookie is set for the whole
+// target.com domain, which also covers api.target.com.
+func (s *TargetSession) Restore(snap Snapshot) {
+	cookies := make([]*fhttp.Cookie, 0, len(snap.Cookies))
+	for name, value := range snap.Cookies {
+		cookies = append(cookies, &fhttp.Cookie{Name: name, Value: value, Domain: ".target.com", Path: "/", Secure: true})
+	}
+	if u, err := url.Parse(targetBaseURL); err == nil {
+		s.client.SetCookies(u, cookies)
+	}
+	if snap.DeviceID != "" {
+		s.deviceID = snap.DeviceID
+	}
+	if snap.VisitorID != "" {
+		s.VisitorID = snap.VisitorID
+	}
+	s.tealeafID = snap.Cookies["TealeafAkaSid"]
+	log.Printf("[session] restored %d cookies saved %s", len(cookies), snap.SavedAt.Local().Format(time.DateTime))
+}
+
+// Store keeps one saved session per profile as a file in a directory.
+// The files hold live auth tokens, so the directory is created 0700 and
+// each file 0600.
+type Store struct {
+	dir string
+}
+
+// NewStore returns a Store that keeps sessions in dir. The directory is
+// created on the first Save.
+func NewStore(dir string) *Store {
+	return &Store{dir: dir}
+}
+
+// Load returns the session saved for profile, or ErrNoSavedSession.
+func (st *Store) Load(profile string) (Snapshot, error) {
+	raw, err := os.ReadFile(st.path(profile))
+	if errors.Is(err, os.ErrNotExist) {
+		return Snapshot{}, fmt.Errorf("%s: %w", profile, ErrNoSavedSession)
+	}
+	if err != nil {
+		return Snapshot{}, fmt.Errorf("failed to read saved session: %w", err)
+	}
+	var snap Snapshot
+	if err := json.Unmarshal(raw, &snap); err != nil {
+		return Snapshot{}, fmt.Errorf("failed to parse saved session %s: %w", st.path(profile), err)
+	}
+	return snap, nil
+}
+
+// Save replaces the session saved for profile.
+func (st *Store) Save(profile string, snap Snapshot) error {
+	raw, err := json.Marshal(snap)
+	if err != nil {
+		return fmt.Errorf("failed to marshal session: %w", err)
+	}
+	if err := os.MkdirAll(st.dir, 0o700); err != nil {
+		return fmt.Errorf("failed to create session directory: %w", err)
+	}
+	tmp, err := os.CreateTemp(st.dir, ".session-*")
+	if err != nil {
+		return fmt.Errorf("failed to write session: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(raw); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write session: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write session: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), st.path(profile)); err != nil {
+		return fmt.Errorf("failed to write session: %w", err)
+	}
+	return nil
+}
+
+func (st *Store) path(profile string) string {
+	return filepath.Join(st.dir, url.PathEscape(profile)+".json")
+}
@@ -2,6 +2,7 @@ package session
 
 import (
 	"bytes"
+	"context"
 	"crypto/rand"
 	"encoding/hex"
 	"encoding/json"
@@ -33,6 +34,9 @@ const (
 // pxCookieNames lists the PerimeterX cookies we need to track.
 var pxCookieNames = []string{"_px3", "_pxvid", "_pxhd"}
 
+// authCookieNames lists the cookies Target sets on a logged-in session.
+var authCookieNames = []string{"accessToken", "refreshToken", "idToken", "login-session"}
+
 // visitorIDPattern matches the visitorId value embedded in Target's HTML/scripts.
 var visitorIDPattern = regexp.MustCompile(`"visitorId"\s*:\s*"([A-Za-z0-9-]+)"`)
 
@@ -105,6 +109,18 @@ func (s *TargetSession) GetCookies() map[string]string {
 	return result
 }
 
+// AuthCookies returns the login cookies currently held in the jar, keyed
+// by name. An empty map means the session is not authenticated.
+func (s *TargetSession) AuthCookies() map[string]string {
+	result := make(map[string]string)
+	for _, name := range authCookieNames {
+		if v := s.getCookieValue(targetBaseURL, name); v != "" {
+			result[name] = v
+		}
+	}
+	return result
+}
+
 // getCookieValue returns the value of a named cookie for the given URL,
 // or an empty string if not found.
 func (s *TargetSession) getCookieValue(rawURL, name string) string {
@@ -121,14 +137,15 @@ func (s *TargetSession) getCookieValue(rawURL, name string) string {
 }
 
 // Do executes an HTTP request via the TLS client and returns the
-// status code and response body.
-func (s *TargetSession) Do(method, rawURL string, headers map[string]string, body []byte) (int, []byte, error) {
+// status code and response body. ctx bounds the whole request, on top of
+// the client's fixed 30s timeout.
+func (s *TargetSession) Do(ctx context.Context, method, rawURL string, headers map[string]string, body []byte) (int, []byte, error) {
 	var bodyReader io.Reader
 	if len(body) > 0 {
 		bodyReader = bytes.NewReader(body)
 	}
 
-	req, err := fhttp.NewRequest(method, rawURL, bodyReader)
+	req, err := fhttp.NewRequestWithContext(ctx, method, rawURL, bodyReader)
 	if err != nil {
 		return 0, nil, fmt.Errorf("failed to build request: %w", err)
 	}
@@ -168,9 +185,9 @@ func gspHeaders() map[string]string {
 //  1. GET target.com — populate cookie jar, extract visitorId
 //  2. POST client_tokens (client_credentials grant) — establish login-session
 //     and TealeafAkaSid cookies needed before credential_validations
-func (s *TargetSession) WarmUp() error {
+func (s *TargetSession) WarmUp(ctx context.Context) error {
 	headers := models.DefaultHeaders()
-	status, body, err := s.Do("GET", targetBaseURL, headers, nil)
+	status, body, err := s.Do(ctx, "GET", targetBaseURL, headers, nil)
 	if err != nil {
 		return fmt.Errorf("warm-up request failed: %w", err)
 	}
@@ -202,7 +219,7 @@ func (s *TargetSession) WarmUp() error {
 	loginHeaders["Sec-Fetch-Dest"] = "document"
 	loginHeaders["Accept"] = "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8"
 
-	loginStatus, _, err := s.Do("GET", targetLoginPageURL, loginHeaders, nil)
+	loginStatus, _, err := s.Do(ctx, "GET", targetLoginPageURL, loginHeaders, nil)
 	if err != nil {
 		return fmt.Errorf("login page request failed: %w", err)
 	}
@@ -223,8 +240,8 @@ func (s *TargetSession) WarmUp() error {
 // Login authenticates with a Target account using a real headless browser
 // (go-rod) to bypass PerimeterX, then injects the resulting cookies into
 // the TLS client for fast ATC/checkout API calls.
-func (s *TargetSession) Login(email, password string) error {
-	result, err := BrowserLogin(email, password)
+func (s *TargetSession) Login(ctx context.Context, email, password string) error {
+	result, err := BrowserLogin(ctx, email, password)
 	if err != nil {
 		return fmt.Errorf("browser login failed: %w", err)
 	}
@@ -278,7 +295,7 @@ func (s *TargetSession) injectCookies(cookies []*stdhttp.Cookie) {
 
 // credentialValidation submits email and password to Target's auth service.
 // Returns the OAuth authorization code from the 202 response body.
-func (s *TargetSession) credentialValidation(email, password string) (string, error) {
+func (s *TargetSession) credentialValidation(ctx context.Context, email, password string) (string, error) {
 	payload := models.LoginRequest{
 		Username:       email,
 		Password:       password,
@@ -290,7 +307,7 @@ func (s *TargetSession) credentialValidation(email, password string) (string, er
 		return "", fmt.Errorf("failed to marshal payload: %w", err)
 	}
 
-	status, respBody, err := s.Do("POST", credValidationsURL, gspHeaders(), body)
+	status, respBody, err := s.Do(ctx, "POST", credValidationsURL, gspHeaders(), body)
 	if err != nil {
 		return "", fmt.Errorf("request failed: %w", err)
 	}
@@ -314,8 +331,8 @@ func (s *TargetSession) credentialValidation(email, password string) (string, er
 
 // skipPhoneVerification posts to the skip-2FA endpoint. Target shows this
 // prompt on accounts that haven't registered a phone number.
-func (s *TargetSession) skipPhoneVerification() error {
-	status, respBody, err := s.Do("POST", skipPhoneURL, gspHeaders(), nil)
+func (s *TargetSession) skipPhoneVerification(ctx context.Context) error {
+	status, respBody, err := s.Do(ctx, "POST", skipPhoneURL, gspHeaders(), nil)
 	if err != nil {
 		return fmt.Errorf("request failed: %w", err)
 	}
@@ -329,7 +346,7 @@ func (s *TargetSession) skipPhoneVerification() error {
 // fetchClientTokens posts to the OAuth token endpoint.
 // grantType is either "client_credentials" (anonymous warm-up) or
 // "authorization_code" (authenticated login, requires code).
-func (s *TargetSession) fetchClientTokens(grantType, code string) error {
+func (s *TargetSession) fetchClientTokens(ctx context.Context, grantType, code string) error {
 	payload := models.ClientTokensRequest{
 		GrantType:        grantType,
 		ClientCredential: models.ClientCredential{ClientID: "ecom-web-1.0.0"},
@@ -342,7 +359,7 @@ func (s *TargetSession) fetchClientTokens(grantType, code string) error {
 		return fmt.Errorf("failed to marshal payload: %w", err)
 	}
 
-	status, respBody, err := s.Do("POST", clientTokensURL, gspHeaders(), body)
+	status, respBody, err := s.Do(ctx, "POST", clientTokensURL, gspHeaders(), body)
 	if err != nil {
 		return fmt.Errorf("request failed: %w", err)
 	}
@@ -356,8 +373,8 @@ func (s *TargetSession) fetchClientTokens(grantType, code string) error {
 
 // validateTokens confirms the issued tokens are valid. The server reads the
 // accessToken cookie; the request body is an empty JSON object.
-func (s *TargetSession) validateTokens() error {
-	status, respBody, err := s.Do("POST", tokenValidationsURL, gspHeaders(), []byte("{}"))
+func (s *TargetSession) validateTokens(ctx context.Context) error {
+	status, respBody, err := s.Do(ctx, "POST", tokenValidationsURL, gspHeaders(), []byte("{}"))
 	if err != nil {
 		return fmt.Errorf("request failed: %w", err)
 	}
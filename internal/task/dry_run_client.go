@@ -0,0 +1,129 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"zeng_bot/internal/models"
+)
+
+// DryRunClient wraps another CheckoutClient and forwards every call up to
+// and including ReviewTotals. PlaceOrder and ConfirmOrder are logged and
+// skipped, as are calls that remove or change items already in the cart.
+// Use it to exercise the whole flow against the real API without placing
+// an order.
+type DryRunClient struct {
+	Client CheckoutClient
+}
+
+// LoggedIn forwards to the wrapped client.
+func (c *DryRunClient) LoggedIn() bool {
+	return c.Client.LoggedIn()
+}
+
+// Login forwards to the wrapped client.
+func (c *DryRunClient) Login(ctx context.Context) error {
+	return c.Client.Login(ctx)
+}
+
+// AddToCart forwards to the wrapped client.
+func (c *DryRunClient) AddToCart(ctx context.Context, event models.StockEvent, quantity int, mode models.FulfillmentMode) (string, error) {
+	return c.Client.AddToCart(ctx, event, quantity, mode)
+}
+
+// GetCart forwards to the wrapped client.
+func (c *DryRunClient) GetCart(ctx context.Context) (models.Cart, error) {
+	return c.Client.GetCart(ctx)
+}
+
+// RemoveItem logs the removal and returns the unchanged cart.
+func (c *DryRunClient) RemoveItem(ctx context.Context, cartItemID string) (models.Cart, error) {
+	log.Printf("[dry-run] skipping RemoveItem for cart item %s", cartItemID)
+	return c.Client.GetCart(ctx)
+}
+
+// UpdateQuantity logs the change and returns the unchanged cart.
+func (c *DryRunClient) UpdateQuantity(ctx context.Context, cartItemID string, quantity int) (models.Cart, error) {
+	log.Printf("[dry-run] skipping UpdateQuantity to %d for cart item %s", quantity, cartItemID)
+	return c.Client.GetCart(ctx)
+}
+
+// ClearCart logs and skips clearing the cart.
+func (c *DryRunClient) ClearCart(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	log.Printf("[dry-run] skipping ClearCart")
+	return nil
+}
+
+// SelectFulfillment forwards to the wrapped client.
+func (c *DryRunClient) SelectFulfillment(ctx context.Context, cartID string, task models.Task, profile models.Profile) (models.CartItemFulfillment, error) {
+	return c.Client.SelectFulfillment(ctx, cartID, task, profile)
+}
+
+// ApplyPayment forwards to the wrapped client.
+func (c *DryRunClient) ApplyPayment(ctx context.Context, cartID string, profile models.Profile) ([]models.Tender, error) {
+	return c.Client.ApplyPayment(ctx, cartID, profile)
+}
+
+// ReviewTotals forwards to the wrapped client.
+func (c *DryRunClient) ReviewTotals(ctx context.Context, cartID string) (models.CartSummary, error) {
+	return c.Client.ReviewTotals(ctx, cartID)
+}
+
+// PlaceOrder logs the order that would have been placed and returns an
+// empty order ID without contacting the checkout API.
+func (c *DryRunClient) PlaceOrder(ctx context.Context, cartID string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	log.Printf("[dry-run] skipping PlaceOrder for cart %s", cartID)
+	return "", nil
+}
+
+// GiftCardBalance forwards to the wrapped client; a balance check spends
+// nothing.
+func (c *DryRunClient) GiftCardBalance(ctx context.Context, card models.GiftCard) (models.Money, error) {
+	checker, ok := c.Client.(BalanceChecker)
+	if !ok {
+		return 0, errors.New("client cannot check gift card balances")
+	}
+	return checker.GiftCardBalance(ctx, card)
+}
+
+// OrderStatus forwards to the wrapped client; it only reads the order.
+func (c *DryRunClient) OrderStatus(ctx context.Context, orderID string) (models.OrderStatus, error) {
+	checker, ok := c.Client.(StatusChecker)
+	if !ok {
+		return "", errors.New("client cannot check order status")
+	}
+	return checker.OrderStatus(ctx, orderID)
+}
+
+// CancelOrder logs and skips the cancellation, reporting the order's
+// current status if the wrapped client can read it.
+func (c *DryRunClient) CancelOrder(ctx context.Context, orderID, reason string) (models.OrderStatus, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	log.Printf("[dry-run] skipping CancelOrder for order %s (reason %s)", orderID, reason)
+	if _, ok := c.Client.(StatusChecker); !ok {
+		return "", nil
+	}
+	return c.OrderStatus(ctx, orderID)
+}
+
+// ConfirmOrder does nothing; a dry run has no order to confirm.
+func (c *DryRunClient) ConfirmOrder(ctx context.Context, orderID string) error {
+	return ctx.Err()
+}
+
+// compile-time check: DryRunClient must satisfy CheckoutClient.
+var (
+	_ CheckoutClient = (*DryRunClient)(nil)
+	_ BalanceChecker = (*DryRunClient)(nil)
+	_ StatusChecker  = (*DryRunClient)(nil)
+	_ OrderCanceller = (*DryRunClient)(nil)
+)
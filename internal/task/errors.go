@@ -0,0 +1,237 @@
+package task
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"zeng_bot/internal/budget"
+	"zeng_bot/internal/models"
+)
+
+// Sentinel errors classifying checkout failures. Errors returned by
+// CheckoutClient implementations wrap one of these where the cause is
+// known, so callers can use errors.Is to decide whether to retry,
+// re-login or stop.
+var (
+	// ErrOutOfStock means the item sold out between the stock event and
+	// the request.
+	ErrOutOfStock = errors.New("out of stock")
+	// ErrPaymentDeclined means the card was declined or rejected.
+	ErrPaymentDeclined = errors.New("payment declined")
+	// ErrSessionExpired means the session is no longer authenticated and
+	// must log in again.
+	ErrSessionExpired = errors.New("session expired")
+	// ErrRateLimited means Target asked us to slow down (HTTP 429).
+	ErrRateLimited = errors.New("rate limited")
+	// ErrPurchaseLimit means the account has reached the item's
+	// per-guest limit.
+	ErrPurchaseLimit = errors.New("purchase limit reached")
+	// ErrBlocked means the request was stopped by bot protection.
+	ErrBlocked = errors.New("blocked by bot protection")
+	// ErrServer means Target returned a 5xx error.
+	ErrServer = errors.New("server error")
+	// ErrTransient means the request failed before a response arrived,
+	// e.g. a reset connection or a timeout.
+	ErrTransient = errors.New("transient network error")
+	// ErrRejected is any other 4xx response.
+	ErrRejected = errors.New("request rejected")
+	// ErrUnrelatedItems means the cart holds items from outside the task
+	// and its cart policy is to abort.
+	ErrUnrelatedItems = errors.New("cart holds unrelated items")
+	// ErrPriceLimit means the cart costs more than the task allows. It
+	// is raised by the worker, not Target, before the order is placed.
+	ErrPriceLimit = errors.New("over price limit")
+	// ErrCVVRequired means Target wants the CVV of a wallet card and it
+	// could not be supplied.
+	ErrCVVRequired = errors.New("cvv required")
+	// ErrNoSavedCard means the profile's saved card is not in the
+	// account's wallet and there is no card to enter instead.
+	ErrNoSavedCard = errors.New("saved card not found")
+	// ErrNotCancellable means Target refused to cancel an order, usually
+	// because it has already been released for shipping or pickup.
+	ErrNotCancellable = errors.New("order cannot be cancelled")
+)
+
+// APIError describes a non-2xx response from a Target API. It unwraps to
+// the sentinel in Kind.
+type APIError struct {
+	// Op names the request, e.g. "ATC" or "payment".
+	Op     string
+	Status int
+	// Code is Target's error code from the body, if any.
+	Code    string
+	Message string
+	Kind    error
+}
+
+func (e *APIError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s: %v (status %d", e.Op, e.Kind, e.Status)
+	if e.Code != "" {
+		fmt.Fprintf(&b, ", code %s", e.Code)
+	}
+	b.WriteString(")")
+	if e.Message != "" {
+		fmt.Fprintf(&b, ": %s", e.Message)
+	}
+	return b.String()
+}
+
+func (e *APIError) Unwrap() error {
+	return e.Kind
+}
+
+// errorCodes maps Target error codes to sentinels.
+var errorCodes = map[string]error{
+	"OUT_OF_STOCK":                  ErrOutOfStock,
+	"ITEM_OUT_OF_STOCK":             ErrOutOfStock,
+	"INSUFFICIENT_INVENTORY":        ErrOutOfStock,
+	"ITEM_NOT_AVAILABLE":            ErrOutOfStock,
+	"ITEM_UNAVAILABLE":              ErrOutOfStock,
+	"EXCEEDED_PURCHASE_LIMIT":       ErrPurchaseLimit,
+	"PURCHASE_LIMIT_EXCEEDED":       ErrPurchaseLimit,
+	"MAX_PURCHASE_LIMIT_EXCEEDED":   ErrPurchaseLimit,
+	"QUANTITY_LIMIT_EXCEEDED":       ErrPurchaseLimit,
+	"PAYMENT_DECLINED":              ErrPaymentDeclined,
+	"CARD_DECLINED":                 ErrPaymentDeclined,
+	"PAYMENT_AUTHORIZATION_FAILED":  ErrPaymentDeclined,
+	"INVALID_CVV":                   ErrPaymentDeclined,
+	"INVALID_CARD_NUMBER":           ErrPaymentDeclined,
+	"CARD_EXPIRED":                  ErrPaymentDeclined,
+	"INVALID_GIFT_CARD":             ErrPaymentDeclined,
+	"INVALID_GIFT_CARD_PIN":         ErrPaymentDeclined,
+	"GIFT_CARD_ZERO_BALANCE":        ErrPaymentDeclined,
+	"MISSING_CREDIT_CARD_CVV":       ErrCVVRequired,
+	"CVV_REQUIRED":                  ErrCVVRequired,
+	"ORDER_NOT_CANCELLABLE":         ErrNotCancellable,
+	"CANCELLATION_WINDOW_EXPIRED":   ErrNotCancellable,
+	"ORDER_ALREADY_RELEASED":        ErrNotCancellable,
+	"UNAUTHORIZED":                  ErrSessionExpired,
+	"AUTHENTICATION_REQUIRED":       ErrSessionExpired,
+	"INVALID_TOKEN":                 ErrSessionExpired,
+	"TOKEN_EXPIRED":                 ErrSessionExpired,
+	"SESSION_EXPIRED":               ErrSessionExpired,
+	"GUEST_NOT_AUTHENTICATED":       ErrSessionExpired,
+	"TOO_MANY_REQUESTS":             ErrRateLimited,
+	"RATE_LIMIT_EXCEEDED":           ErrRateLimited,
+	"SERVICE_UNAVAILABLE":           ErrServer,
+	"INTERNAL_SERVER_ERROR":         ErrServer,
+	"PAYMENT_SERVICE_UNAVAILABLE":   ErrServer,
+	"PAYMENT_PROCESSING_EXCEPTION":  ErrServer,
+	"CART_LOCKED":                   ErrServer,
+	"MISSING_OR_INVALID_PARAMETERS": ErrRejected,
+}
+
+// errorPhrases catch bodies without a known code, matched against the
+// lower-cased message.
+var errorPhrases = []struct {
+	phrase string
+	kind   error
+}{
+	{"out of stock", ErrOutOfStock},
+	{"sold out", ErrOutOfStock},
+	{"purchase limit", ErrPurchaseLimit},
+	{"quantity limit", ErrPurchaseLimit},
+	{"declined", ErrPaymentDeclined},
+	{"not authenticated", ErrSessionExpired},
+	{"session expired", ErrSessionExpired},
+}
+
+// blockMarkers appear in PerimeterX block pages.
+var blockMarkers = []string{"px-captcha", "perimeterx", "blockscript", `"appid":"px`}
+
+// ParseAPIError classifies a non-2xx response from the Target API named
+// op. The body's error code wins over the status code, so a 400 that
+// says OUT_OF_STOCK is reported as ErrOutOfStock rather than
+// ErrRejected.
+func ParseAPIError(op string, status int, body []byte) *APIError {
+	e := &APIError{Op: op, Status: status}
+
+	var resp models.TargetErrorResponse
+	if json.Unmarshal(body, &resp) == nil {
+		e.Code, e.Message = firstError(resp)
+	}
+	if kind, ok := errorCodes[strings.ToUpper(e.Code)]; ok {
+		e.Kind = kind
+		return e
+	}
+
+	lower := strings.ToLower(e.Message)
+	for _, p := range errorPhrases {
+		if lower != "" && strings.Contains(lower, p.phrase) {
+			e.Kind = p.kind
+			return e
+		}
+	}
+
+	switch {
+	case status == http.StatusTooManyRequests:
+		e.Kind = ErrRateLimited
+	case status >= 500:
+		e.Kind = ErrServer
+	case status == http.StatusForbidden && isBlockPage(body):
+		e.Kind = ErrBlocked
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		e.Kind = ErrSessionExpired
+	default:
+		e.Kind = ErrRejected
+	}
+	return e
+}
+
+// firstError returns the first code and message found in resp.
+func firstError(resp models.TargetErrorResponse) (code, message string) {
+	code, message = resp.Code, resp.Message
+	if code == "" {
+		code = resp.ErrorCode
+	}
+	for _, list := range [][]models.TargetErrorEntry{resp.Errors, resp.Alerts} {
+		for _, entry := range list {
+			if code == "" {
+				code = entry.Code
+				if code == "" {
+					code = entry.Reason
+				}
+			}
+			if message == "" {
+				message = entry.Message
+			}
+		}
+	}
+	return code, message
+}
+
+func isBlockPage(body []byte) bool {
+	lower := strings.ToLower(string(body))
+	for _, m := range blockMarkers {
+		if strings.Contains(lower, m) {
+			return true
+		}
+	}
+	return false
+}
+
+// Transient reports whether err is likely to succeed if retried as is:
+// rate limits, 5xx responses and network failures. Cancellation is not
+// transient.
+func Transient(err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	return errors.Is(err, ErrRateLimited) || errors.Is(err, ErrServer) ||
+		errors.Is(err, ErrTransient) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// Fatal reports whether the task should stop rather than wait for the
+// next restock: err will recur on every attempt, or an order may already
+// exist and another attempt could buy the item twice.
+func Fatal(err error) bool {
+	return errors.Is(err, ErrPaymentDeclined) || errors.Is(err, ErrPurchaseLimit) ||
+		errors.Is(err, ErrOrderUnknown) || errors.Is(err, budget.ErrExceeded) ||
+		errors.Is(err, ErrUnrelatedItems) || errors.Is(err, ErrCVVRequired) ||
+		errors.Is(err, ErrNoSavedCard)
+}
@@ -0,0 +1,169 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"zeng_bot/internal/budget"
+)
+
+// codeKinds is the sentinel every Target error code should map to.
+var codeKinds = map[string]error{
+	"OUT_OF_STOCK":                  ErrOutOfStock,
+	"ITEM_OUT_OF_STOCK":             ErrOutOfStock,
+	"INSUFFICIENT_INVENTORY":        ErrOutOfStock,
+	"ITEM_NOT_AVAILABLE":            ErrOutOfStock,
+	"ITEM_UNAVAILABLE":              ErrOutOfStock,
+	"EXCEEDED_PURCHASE_LIMIT":       ErrPurchaseLimit,
+	"PURCHASE_LIMIT_EXCEEDED":       ErrPurchaseLimit,
+	"MAX_PURCHASE_LIMIT_EXCEEDED":   ErrPurchaseLimit,
+	"QUANTITY_LIMIT_EXCEEDED":       ErrPurchaseLimit,
+	"PAYMENT_DECLINED":              ErrPaymentDeclined,
+	"CARD_DECLINED":                 ErrPaymentDeclined,
+	"PAYMENT_AUTHORIZATION_FAILED":  ErrPaymentDeclined,
+	"INVALID_CVV":                   ErrPaymentDeclined,
+	"INVALID_CARD_NUMBER":           ErrPaymentDeclined,
+	"CARD_EXPIRED":                  ErrPaymentDeclined,
+	"INVALID_GIFT_CARD":             ErrPaymentDeclined,
+	"INVALID_GIFT_CARD_PIN":         ErrPaymentDeclined,
+	"GIFT_CARD_ZERO_BALANCE":        ErrPaymentDeclined,
+	"MISSING_CREDIT_CARD_CVV":       ErrCVVRequired,
+	"CVV_REQUIRED":                  ErrCVVRequired,
+	"ORDER_NOT_CANCELLABLE":         ErrNotCancellable,
+	"CANCELLATION_WINDOW_EXPIRED":   ErrNotCancellable,
+	"ORDER_ALREADY_RELEASED":        ErrNotCancellable,
+	"UNAUTHORIZED":                  ErrSessionExpired,
+	"AUTHENTICATION_REQUIRED":       ErrSessionExpired,
+	"INVALID_TOKEN":                 ErrSessionExpired,
+	"TOKEN_EXPIRED":                 ErrSessionExpired,
+	"SESSION_EXPIRED":               ErrSessionExpired,
+	"GUEST_NOT_AUTHENTICATED":       ErrSessionExpired,
+	"TOO_MANY_REQUESTS":             ErrRateLimited,
+	"RATE_LIMIT_EXCEEDED":           ErrRateLimited,
+	"SERVICE_UNAVAILABLE":           ErrServer,
+	"INTERNAL_SERVER_ERROR":         ErrServer,
+	"PAYMENT_SERVICE_UNAVAILABLE":   ErrServer,
+	"PAYMENT_PROCESSING_EXCEPTION":  ErrServer,
+	"CART_LOCKED":                   ErrServer,
+	"MISSING_OR_INVALID_PARAMETERS": ErrRejected,
+}
+
+func TestParseAPIErrorCodes(t *testing.T) {
+	for code := range errorCodes {
+		if _, ok := codeKinds[code]; !ok {
+			t.Errorf("error code %s has no expected kind in codeKinds", code)
+		}
+	}
+	for code, want := range codeKinds {
+		// A 400 is the least specific status, so only the code can
+		// decide the kind.
+		body := fmt.Sprintf(`{"code":%q,"message":"something went wrong"}`, code)
+		e := ParseAPIError("op", http.StatusBadRequest, []byte(body))
+		if !errors.Is(e, want) {
+			t.Errorf("code %s = %v, want %v", code, e.Kind, want)
+		}
+		if e.Code != code {
+			t.Errorf("code %s parsed as %q", code, e.Code)
+		}
+	}
+}
+
+func TestParseAPIError(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		want   error
+	}{
+		// Where the code is found.
+		{"error_code", 400, `{"error_code":"CARD_DECLINED"}`, ErrPaymentDeclined},
+		{"errors list", 400, `{"errors":[{"code":"ITEM_OUT_OF_STOCK","message":"gone"}]}`, ErrOutOfStock},
+		{"alerts reason", 400, `{"alerts":[{"reason":"EXCEEDED_PURCHASE_LIMIT"}]}`, ErrPurchaseLimit},
+		{"lower-case code", 400, `{"code":"session_expired"}`, ErrSessionExpired},
+		{"code wins over status", 500, `{"code":"OUT_OF_STOCK"}`, ErrOutOfStock},
+
+		// Unknown codes fall back to the message, then the status.
+		{"unknown code, known phrase", 400, `{"code":"SOMETHING_NEW","message":"This item is Sold Out"}`, ErrOutOfStock},
+		{"unknown code, declined", 400, `{"code":"SOMETHING_NEW","message":"Your card was declined"}`, ErrPaymentDeclined},
+		{"unknown code, 400", 400, `{"code":"SOMETHING_NEW","message":"nope"}`, ErrRejected},
+		{"unknown code, 429", 429, `{"code":"SOMETHING_NEW"}`, ErrRateLimited},
+		{"unknown code, 503", 503, `{"code":"SOMETHING_NEW"}`, ErrServer},
+		{"unknown code, 401", 401, `{"code":"SOMETHING_NEW"}`, ErrSessionExpired},
+
+		// Bodies that are not JSON.
+		{"empty 400", 400, ``, ErrRejected},
+		{"empty 404", 404, ``, ErrRejected},
+		{"empty 429", 429, ``, ErrRateLimited},
+		{"HTML 502", 502, `<html><body>Bad Gateway</body></html>`, ErrServer},
+		{"plain text 401", 401, `Unauthorized`, ErrSessionExpired},
+		{"plain text out of stock", 400, `out of stock`, ErrRejected},
+		{"block page", 403, `<html><div id="px-captcha"></div></html>`, ErrBlocked},
+		{"403 without a block page", 403, `Forbidden`, ErrSessionExpired},
+		{"truncated JSON", 400, `{"code":"OUT_OF_ST`, ErrRejected},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := ParseAPIError("op", tt.status, []byte(tt.body))
+			if !errors.Is(e, tt.want) {
+				t.Errorf("ParseAPIError(%d, %q) = %v, want %v", tt.status, tt.body, e.Kind, tt.want)
+			}
+			if e.Status != tt.status {
+				t.Errorf("Status = %d, want %d", e.Status, tt.status)
+			}
+		})
+	}
+}
+
+func TestAPIErrorMessage(t *testing.T) {
+	e := ParseAPIError("ATC", 400, []byte(`{"code":"OUT_OF_STOCK","message":"Item is out of stock"}`))
+	want := "ATC: out of stock (status 400, code OUT_OF_STOCK): Item is out of stock"
+	if got := e.Error(); got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+}
+
+func TestTransientAndFatal(t *testing.T) {
+	tests := []struct {
+		err       error
+		transient bool
+		fatal     bool
+	}{
+		{ErrRateLimited, true, false},
+		{ErrServer, true, false},
+		{ErrTransient, true, false},
+		{context.DeadlineExceeded, true, false},
+		{context.Canceled, false, false},
+		{ErrOutOfStock, false, false},
+		{ErrSessionExpired, false, false},
+		{ErrBlocked, false, false},
+		{ErrRejected, false, false},
+		{ErrNotCancellable, false, false},
+		{ErrPriceLimit, false, false},
+		{ErrPaymentDeclined, false, true},
+		{ErrPurchaseLimit, false, true},
+		{ErrOrderUnknown, false, true},
+		{budget.ErrExceeded, false, true},
+		{ErrUnrelatedItems, false, true},
+		{ErrCVVRequired, false, true},
+		{ErrNoSavedCard, false, true},
+	}
+	for _, tt := range tests {
+		// Classification must survive wrapping, as every stage wraps.
+		for _, err := range []error{tt.err, fmt.Errorf("stage: %w", tt.err), &APIError{Op: "op", Kind: tt.err}} {
+			if got := Transient(err); got != tt.transient {
+				t.Errorf("Transient(%v) = %t, want %t", err, got, tt.transient)
+			}
+			if got := Fatal(err); got != tt.fatal {
+				t.Errorf("Fatal(%v) = %t, want %t", err, got, tt.fatal)
+			}
+		}
+	}
+	// A cancelled context is never retried, even when the request that
+	// was cut short also reports a network error.
+	if err := fmt.Errorf("%w: %w", ErrTransient, context.Canceled); Transient(err) {
+		t.Errorf("Transient(%v) = true, want false", err)
+	}
+}
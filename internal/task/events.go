@@ -0,0 +1,108 @@
+package task
+
+import (
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+)
+
+// StateChange is published on a Bus each time a worker changes state.
+// Err is set when the worker moved to StateFailed.
+type StateChange struct {
+	WorkerID int
+	TaskID   string
+	From     State
+	To       State
+	At       time.Time
+	Elapsed  time.Duration
+	Err      error
+}
+
+// MarshalJSON writes states by name and the error as a string.
+func (c StateChange) MarshalJSON() ([]byte, error) {
+	type record struct {
+		WorkerID  int       `json:"worker_id"`
+		TaskID    string    `json:"task_id"`
+		From      string    `json:"from"`
+		To        string    `json:"to"`
+		At        time.Time `json:"at"`
+		ElapsedMS int64     `json:"elapsed_ms"`
+		Error     string    `json:"error,omitempty"`
+	}
+	r := record{
+		WorkerID:  c.WorkerID,
+		TaskID:    c.TaskID,
+		From:      c.From.String(),
+		To:        c.To.String(),
+		At:        c.At,
+		ElapsedMS: c.Elapsed.Milliseconds(),
+	}
+	if c.Err != nil {
+		r.Error = c.Err.Error()
+	}
+	return json.Marshal(r)
+}
+
+// Bus fans StateChanges out to any number of subscribers. Publish never
+// blocks: a subscriber that falls behind loses events rather than stall
+// a checkout.
+type Bus struct {
+	mu     sync.RWMutex
+	subs   map[chan StateChange]struct{}
+	closed bool
+}
+
+// NewBus returns a bus with no subscribers.
+func NewBus() *Bus {
+	return &Bus{subs: make(map[chan StateChange]struct{})}
+}
+
+// Subscribe returns a channel receiving every event published from now
+// on, buffered to hold buffer events, and a function that unsubscribes
+// and closes it. The channel is also closed when the bus is.
+func (b *Bus) Subscribe(buffer int) (<-chan StateChange, func()) {
+	ch := make(chan StateChange, buffer)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		close(ch)
+		return ch, func() {}
+	}
+	b.subs[ch] = struct{}{}
+	return ch, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, ok := b.subs[ch]; ok {
+			delete(b.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// Publish sends c to every subscriber with room for it.
+func (b *Bus) Publish(c StateChange) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for ch := range b.subs {
+		select {
+		case ch <- c:
+		default:
+			log.Printf("[bus] subscriber full, dropped %s worker %d -> %s", c.TaskID, c.WorkerID, c.To)
+		}
+	}
+}
+
+// Close closes every subscriber's channel. Later publishes are ignored.
+func (b *Bus) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return
+	}
+	b.closed = true
+	for ch := range b.subs {
+		close(ch)
+		delete(b.subs, ch)
+	}
+}
@@ -1,13 +1,79 @@
 package task
 
-import "zeng_bot/internal/models"
+import (
+	"context"
 
-// CheckoutClient defines the HTTP operations required for a checkout flow.
-// Implementations must use a TLS-spoofing client (e.g. bogdanfinn/tls-client).
+	"zeng_bot/internal/models"
+)
+
+// CheckoutClient defines the HTTP operations required for a checkout flow:
+// one per working state of the checkout state machine, plus the cart
+// management workers use to tidy the cart before checking out. Implementations
+// must use a TLS-spoofing client (e.g. bogdanfinn/tls-client) and abort
+// in-flight requests when ctx is cancelled.
 type CheckoutClient interface {
-	// AddToCart sends an add-to-cart request for the given product.
-	AddToCart(event models.StockEvent) (cartID string, err error)
+	// LoggedIn reports whether the session is authenticated. Workers
+	// skip StateLoggingIn when it is.
+	LoggedIn() bool
+
+	// Login authenticates the session with the client's account.
+	Login(ctx context.Context) error
+
+	// AddToCart sends an add-to-cart request for quantity units of the
+	// given product, to be fulfilled with mode. Pickup and drive-up lines
+	// are placed at the product's StoreID.
+	AddToCart(ctx context.Context, event models.StockEvent, quantity int, mode models.FulfillmentMode) (cartID string, err error)
+
+	// GetCart returns the account's cart. Workers use it to verify the
+	// item landed in the cart.
+	GetCart(ctx context.Context) (models.Cart, error)
+
+	// RemoveItem removes a line from the cart and returns the cart.
+	RemoveItem(ctx context.Context, cartItemID string) (models.Cart, error)
+
+	// UpdateQuantity sets a cart line's quantity and returns the cart.
+	UpdateQuantity(ctx context.Context, cartItemID string, quantity int) (models.Cart, error)
+
+	// ClearCart removes every line from the cart.
+	ClearCart(ctx context.Context) error
+
+	// SelectFulfillment sets how the cart is delivered: shipping to the
+	// profile's address or pickup at the task's store. It returns the
+	// fulfillment Target accepted for the task's line.
+	SelectFulfillment(ctx context.Context, cartID string, task models.Task, profile models.Profile) (models.CartItemFulfillment, error)
+
+	// ApplyPayment attaches the profile's gift cards in order, then its
+	// card (or saved wallet card) for whatever they leave. It returns the
+	// tenders applied so far, even on error.
+	ApplyPayment(ctx context.Context, cartID string, profile models.Profile) ([]models.Tender, error)
+
+	// ReviewTotals fetches the final cart totals before the order is
+	// placed.
+	ReviewTotals(ctx context.Context, cartID string) (models.CartSummary, error)
+
+	// PlaceOrder submits the order and returns its ID.
+	PlaceOrder(ctx context.Context, cartID string) (orderID string, err error)
+
+	// ConfirmOrder checks that orderID exists on the account.
+	ConfirmOrder(ctx context.Context, orderID string) error
+}
+
+// BalanceChecker is implemented by clients that can look up a gift card's
+// balance. The orchestrator uses it before the drop so empty or invalid
+// gift cards are not tried at checkout.
+type BalanceChecker interface {
+	GiftCardBalance(ctx context.Context, card models.GiftCard) (models.Money, error)
+}
+
+// StatusChecker is implemented by clients that can read a placed order's
+// status. The order tracker polls it after checkout.
+type StatusChecker interface {
+	OrderStatus(ctx context.Context, orderID string) (models.OrderStatus, error)
+}
 
-	// SubmitPayment finalizes the order with the given cart and profile.
-	SubmitPayment(cartID string, profile models.Profile) (orderID string, err error)
+// OrderCanceller is implemented by clients that can ask Target to cancel
+// a placed order. It returns the order's status after the request, or an
+// empty status if Target accepted it without reporting one.
+type OrderCanceller interface {
+	CancelOrder(ctx context.Context, orderID, reason string) (models.OrderStatus, error)
 }
@@ -0,0 +1,135 @@
+package task
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// transitions lists the states each state may move to. Every working
+// state may fail; only Success and Failed return to Idle. The stages
+// before PlacingOrder may go back to LoggingIn when the session expires,
+// and LoggingIn may resume any of them.
+var transitions = map[State][]State{
+	StateIdle: {StateLoggingIn, StateAddingToCart},
+	StateLoggingIn: {
+		StateAddingToCart, StateVerifyingCart, StateSelectingFulfillment,
+		StateApplyingPayment, StateReviewingTotals, StateFailed,
+	},
+	StateAddingToCart:         {StateVerifyingCart, StateLoggingIn, StateFailed},
+	StateVerifyingCart:        {StateSelectingFulfillment, StateLoggingIn, StateFailed},
+	StateSelectingFulfillment: {StateApplyingPayment, StateLoggingIn, StateFailed},
+	StateApplyingPayment:      {StateReviewingTotals, StateLoggingIn, StateFailed},
+	StateReviewingTotals:      {StatePlacingOrder, StateLoggingIn, StateFailed},
+	StatePlacingOrder:         {StateConfirming, StateFailed},
+	StateConfirming:           {StateSuccess, StateFailed},
+	StateSuccess:              {StateIdle},
+	StateFailed:               {StateIdle},
+}
+
+// ErrIllegalTransition is wrapped by the error Machine.Transition returns
+// for a move the transition table does not allow.
+var ErrIllegalTransition = errors.New("illegal state transition")
+
+// Transition describes a single state change passed to hooks. Elapsed is
+// how long the machine spent in From. Err is the cause of a move to
+// StateFailed made with Fail.
+type Transition struct {
+	From    State
+	To      State
+	At      time.Time
+	Elapsed time.Duration
+	Err     error
+}
+
+// Hook observes a transition. Hooks run synchronously on the worker's
+// goroutine, so they should return quickly.
+type Hook func(Transition)
+
+// Machine enforces the checkout transition table and runs exit hooks
+// before and entry hooks after every state change. State may be read from
+// any goroutine; transitions are made by one goroutine at a time.
+type Machine struct {
+	mu      sync.RWMutex
+	state   State
+	entered time.Time
+	onExit  []Hook
+	onEnter []Hook
+}
+
+// NewMachine returns a machine in StateIdle.
+func NewMachine() *Machine {
+	return &Machine{state: StateIdle, entered: time.Now()}
+}
+
+// State returns the current state.
+func (m *Machine) State() State {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.state
+}
+
+// OnExit registers fn to run before the machine leaves a state.
+func (m *Machine) OnExit(fn Hook) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.onExit = append(m.onExit, fn)
+}
+
+// OnEnter registers fn to run after the machine enters a state.
+func (m *Machine) OnEnter(fn Hook) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.onEnter = append(m.onEnter, fn)
+}
+
+// CanTransition reports whether the table allows moving from the current
+// state to to.
+func (m *Machine) CanTransition(to State) bool {
+	return allowed(m.State(), to)
+}
+
+func allowed(from, to State) bool {
+	for _, s := range transitions[from] {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Transition moves the machine to to, or returns an error wrapping
+// ErrIllegalTransition and leaves the state unchanged.
+func (m *Machine) Transition(to State) error {
+	return m.transition(to, nil)
+}
+
+// Fail moves the machine to StateFailed, passing cause to the hooks.
+func (m *Machine) Fail(cause error) error {
+	return m.transition(StateFailed, cause)
+}
+
+// transition runs the hooks outside the lock so they may call State.
+func (m *Machine) transition(to State, cause error) error {
+	m.mu.RLock()
+	from, entered := m.state, m.entered
+	onExit, onEnter := m.onExit, m.onEnter
+	m.mu.RUnlock()
+
+	if !allowed(from, to) {
+		return fmt.Errorf("%w: %s -> %s", ErrIllegalTransition, from, to)
+	}
+	now := time.Now()
+	t := Transition{From: from, To: to, At: now, Elapsed: now.Sub(entered), Err: cause}
+	for _, fn := range onExit {
+		fn(t)
+	}
+	m.mu.Lock()
+	m.state, m.entered = to, now
+	m.mu.Unlock()
+	for _, fn := range onEnter {
+		fn(t)
+	}
+	return nil
+}
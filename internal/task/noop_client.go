@@ -1,7 +1,9 @@
 package task
 
 import (
+	"context"
 	"log"
+	"sync"
 
 	"zeng_bot/internal/models"
 )
@@ -9,19 +11,222 @@ import (
 // NoOpClient is a skeleton CheckoutClient that satisfies the interface
 // but only logs operations. Use this for testing the worker pool and
 // state machine without making real API calls.
-type NoOpClient struct{}
+type NoOpClient struct {
+	// cart is built up by AddToCart so the cart calls see consistent
+	// contents.
+	cart models.Cart
+
+	// polls counts OrderStatus calls per order, which may come from the
+	// order tracker's goroutines. cancelled holds orders passed to
+	// CancelOrder, which report cancelled from then on.
+	mu        sync.Mutex
+	polls     map[string]int
+	cancelled map[string]bool
+}
+
+// noopStatuses is the progression NoOpClient reports for every order, one
+// step per OrderStatus call.
+var noopStatuses = []models.OrderStatus{models.OrderPlaced, models.OrderProcessing, models.OrderShipped, models.OrderDelivered}
+
+// LoggedIn reports true so workers skip the login stage.
+func (c *NoOpClient) LoggedIn() bool {
+	return true
+}
+
+// Login does nothing.
+func (c *NoOpClient) Login(ctx context.Context) error {
+	return ctx.Err()
+}
 
 // AddToCart logs the request and returns a fake cart ID.
-func (c *NoOpClient) AddToCart(event models.StockEvent) (string, error) {
-	log.Printf("[noop] AddToCart called for DPCI %s at store %s", event.Product.DPCI, event.Product.StoreID)
-	return "fake-cart-id-001", nil
+func (c *NoOpClient) AddToCart(ctx context.Context, event models.StockEvent, quantity int, mode models.FulfillmentMode) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	log.Printf("[noop] AddToCart called for %d x TCIN %s, %s at store %s", quantity, event.Product.TCIN, mode, event.Product.StoreID)
+	c.cart.CartID = "fake-cart-id-001"
+	for i, item := range c.cart.CartItems {
+		if item.TCIN == event.Product.TCIN {
+			c.cart.CartItems[i].Quantity += quantity
+			return c.cart.CartID, nil
+		}
+	}
+	c.cart.CartItems = append(c.cart.CartItems, models.CartItem{
+		CartItemID: "fake-item-" + event.Product.TCIN,
+		TCIN:       event.Product.TCIN,
+		Quantity:   quantity,
+	})
+	return c.cart.CartID, nil
+}
+
+// GetCart logs the request and returns the items added so far.
+func (c *NoOpClient) GetCart(ctx context.Context) (models.Cart, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Cart{}, err
+	}
+	log.Printf("[noop] GetCart called, %d items", len(c.cart.CartItems))
+	return c.snapshot(), nil
+}
+
+// RemoveItem logs the request and drops the line from the fake cart.
+func (c *NoOpClient) RemoveItem(ctx context.Context, cartItemID string) (models.Cart, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Cart{}, err
+	}
+	log.Printf("[noop] RemoveItem called for cart item %s", cartItemID)
+	items := c.cart.CartItems[:0]
+	for _, item := range c.cart.CartItems {
+		if item.CartItemID != cartItemID {
+			items = append(items, item)
+		}
+	}
+	c.cart.CartItems = items
+	return c.snapshot(), nil
+}
+
+// UpdateQuantity logs the request and changes the line in the fake cart.
+func (c *NoOpClient) UpdateQuantity(ctx context.Context, cartItemID string, quantity int) (models.Cart, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Cart{}, err
+	}
+	log.Printf("[noop] UpdateQuantity called for cart item %s, quantity %d", cartItemID, quantity)
+	for i, item := range c.cart.CartItems {
+		if item.CartItemID == cartItemID {
+			c.cart.CartItems[i].Quantity = quantity
+		}
+	}
+	return c.snapshot(), nil
+}
+
+// ClearCart logs the request and empties the fake cart.
+func (c *NoOpClient) ClearCart(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	log.Printf("[noop] ClearCart called")
+	c.cart.CartItems = nil
+	return nil
+}
+
+// snapshot copies the fake cart so callers cannot change it.
+func (c *NoOpClient) snapshot() models.Cart {
+	cart := c.cart
+	cart.CartItems = append([]models.CartItem(nil), c.cart.CartItems...)
+	cart.Summary.ItemsQuantity = 0
+	for _, item := range cart.CartItems {
+		cart.Summary.ItemsQuantity += item.Quantity
+	}
+	return cart
+}
+
+// SelectFulfillment logs the request and accepts the task's mode.
+func (c *NoOpClient) SelectFulfillment(ctx context.Context, cartID string, task models.Task, profile models.Profile) (models.CartItemFulfillment, error) {
+	if err := ctx.Err(); err != nil {
+		return models.CartItemFulfillment{}, err
+	}
+	log.Printf("[noop] SelectFulfillment called for cart %s, %s", cartID, task.Fulfillment)
+	f := models.CartItemFulfillment{Type: task.Fulfillment.CartType()}
+	if task.Fulfillment.IsPickup() {
+		f.LocationID = task.Product.StoreID
+	}
+	return f, nil
+}
+
+// ApplyPayment logs the request and reports each of the profile's
+// tenders as applied, with no amounts.
+func (c *NoOpClient) ApplyPayment(ctx context.Context, cartID string, profile models.Profile) ([]models.Tender, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	log.Printf("[noop] ApplyPayment called for cart %s, profile %s, %d gift cards, card %s",
+		cartID, profile.Name, len(profile.GiftCards), profile.Payment.Masked())
+	var tenders []models.Tender
+	for _, gc := range profile.GiftCards {
+		tenders = append(tenders, models.Tender{Type: models.TenderGiftCard, Last4: gc.Last4()})
+	}
+	if profile.Payment.HasCard() {
+		tenders = append(tenders, models.Tender{Type: models.TenderCard, Last4: profile.Payment.Last4()})
+	}
+	return tenders, nil
+}
+
+// GiftCardBalance logs the request and reports a fixed balance.
+func (c *NoOpClient) GiftCardBalance(ctx context.Context, card models.GiftCard) (models.Money, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	log.Printf("[noop] GiftCardBalance called for %s", card.Masked())
+	return models.Dollars(25), nil
+}
+
+// ReviewTotals logs the request and returns an empty summary.
+func (c *NoOpClient) ReviewTotals(ctx context.Context, cartID string) (models.CartSummary, error) {
+	if err := ctx.Err(); err != nil {
+		return models.CartSummary{}, err
+	}
+	log.Printf("[noop] ReviewTotals called for cart %s", cartID)
+	return c.snapshot().Summary, nil
 }
 
-// SubmitPayment logs the request and returns a fake order ID.
-func (c *NoOpClient) SubmitPayment(cartID string, profile models.Profile) (string, error) {
-	log.Printf("[noop] SubmitPayment called for cart %s, profile %s", cartID, profile.Name)
+// PlaceOrder logs the request and returns a fake order ID.
+func (c *NoOpClient) PlaceOrder(ctx context.Context, cartID string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	log.Printf("[noop] PlaceOrder called for cart %s", cartID)
+	c.cart.CartItems = nil
 	return "fake-order-id-001", nil
 }
 
+// ConfirmOrder logs the request.
+func (c *NoOpClient) ConfirmOrder(ctx context.Context, orderID string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	log.Printf("[noop] ConfirmOrder called for order %s", orderID)
+	return nil
+}
+
+// OrderStatus logs the request and moves the order one step further
+// through noopStatuses on every call.
+func (c *NoOpClient) OrderStatus(ctx context.Context, orderID string) (models.OrderStatus, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.cancelled[orderID] {
+		log.Printf("[noop] OrderStatus called for order %s: %s", orderID, models.OrderCancelled)
+		return models.OrderCancelled, nil
+	}
+	if c.polls == nil {
+		c.polls = make(map[string]int)
+	}
+	status := noopStatuses[min(c.polls[orderID], len(noopStatuses)-1)]
+	c.polls[orderID]++
+	log.Printf("[noop] OrderStatus called for order %s: %s", orderID, status)
+	return status, nil
+}
+
+// CancelOrder logs the request and reports the order cancelled.
+func (c *NoOpClient) CancelOrder(ctx context.Context, orderID, reason string) (models.OrderStatus, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.cancelled == nil {
+		c.cancelled = make(map[string]bool)
+	}
+	c.cancelled[orderID] = true
+	log.Printf("[noop] CancelOrder called for order %s (reason %s)", orderID, reason)
+	return models.OrderCancelled, nil
+}
+
 // compile-time check: NoOpClient must satisfy CheckoutClient.
-var _ CheckoutClient = (*NoOpClient)(nil)
+var (
+	_ CheckoutClient = (*NoOpClient)(nil)
+	_ BalanceChecker = (*NoOpClient)(nil)
+	_ StatusChecker  = (*NoOpClient)(nil)
+	_ OrderCanceller = (*NoOpClient)(nil)
+)
@@ -0,0 +1,317 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"zeng_bot/internal/models"
+)
+
+// ErrOrderUnknown means PlaceOrder failed in a way that may still have
+// placed the order, and the order could not be looked up. Retrying could
+// buy the item twice, so the attempt stops.
+var ErrOrderUnknown = errors.New("order outcome unknown")
+
+// OrderLookup is implemented by clients that can check whether a cart was
+// turned into an order. Workers use it after an ambiguous PlaceOrder
+// failure before deciding to retry.
+type OrderLookup interface {
+	// LookupOrder reports whether the attempt described by q was checked
+	// out, and the order's ID if exactly one order matches it. An order
+	// that cannot be told apart from others is reported as placed with
+	// no ID rather than guessed.
+	LookupOrder(ctx context.Context, q OrderQuery) (orderID string, placed bool, err error)
+}
+
+// OrderQuery describes the checkout attempt an order is looked up for.
+type OrderQuery struct {
+	CartID   string
+	TCIN     string
+	Quantity int
+	// Since is when the attempt started; older orders are not it.
+	Since time.Time
+	// Claimed reports whether an order ID already belongs to another
+	// attempt. It may be nil.
+	Claimed func(orderID string) bool
+}
+
+// OrderClaims records which order IDs belong to which checkout attempt so
+// an order found by LookupOrder is never attributed to two attempts. It
+// is safe for concurrent use; a nil *OrderClaims claims nothing.
+type OrderClaims struct {
+	mu  sync.Mutex
+	ids map[string]bool
+}
+
+// NewOrderClaims returns an empty OrderClaims.
+func NewOrderClaims() *OrderClaims {
+	return &OrderClaims{ids: make(map[string]bool)}
+}
+
+// Claim records orderID as taken. It reports false if it already was.
+func (c *OrderClaims) Claim(orderID string) bool {
+	if c == nil || orderID == "" {
+		return true
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.ids[orderID] {
+		return false
+	}
+	c.ids[orderID] = true
+	return true
+}
+
+// Claimed reports whether orderID has been claimed.
+func (c *OrderClaims) Claimed(orderID string) bool {
+	if c == nil {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ids[orderID]
+}
+
+// RetryPolicy controls how a checkout stage reacts to failure. Only
+// transient errors (see Transient) are retried, with the delay doubling
+// from Backoff up to MaxBackoff between tries.
+type RetryPolicy struct {
+	// Attempts is the most tries the stage gets, including the first.
+	// 1 disables retries.
+	Attempts   int             `json:"attempts,omitempty"`
+	Backoff    models.Duration `json:"backoff,omitempty"`
+	MaxBackoff models.Duration `json:"max_backoff,omitempty"`
+	// Relogin logs in again once per checkout when the stage fails with
+	// ErrSessionExpired, then retries the stage.
+	Relogin *bool `json:"relogin,omitempty"`
+}
+
+// ReloginEnabled reports whether the policy re-authenticates on
+// ErrSessionExpired.
+func (p RetryPolicy) ReloginEnabled() bool {
+	return p.Relogin != nil && *p.Relogin
+}
+
+// delay returns the wait before the try after try number n (1-based).
+func (p RetryPolicy) delay(n int) time.Duration {
+	d := p.Backoff.D()
+	for i := 1; i < n && d < p.MaxBackoff.D(); i++ {
+		d *= 2
+	}
+	if p.MaxBackoff > 0 && d > p.MaxBackoff.D() {
+		d = p.MaxBackoff.D()
+	}
+	return d
+}
+
+// merge returns p with every unset field taken from base.
+func (p RetryPolicy) merge(base RetryPolicy) RetryPolicy {
+	if p.Attempts == 0 {
+		p.Attempts = base.Attempts
+	}
+	if p.Backoff == 0 {
+		p.Backoff = base.Backoff
+	}
+	if p.MaxBackoff == 0 {
+		p.MaxBackoff = base.MaxBackoff
+	}
+	if p.Relogin == nil {
+		p.Relogin = base.Relogin
+	}
+	return p
+}
+
+// retryStages maps the names used in config files to the stages that take
+// a retry policy.
+var retryStages = map[string]State{
+	"login":         StateLoggingIn,
+	"add_to_cart":   StateAddingToCart,
+	"verify_cart":   StateVerifyingCart,
+	"fulfillment":   StateSelectingFulfillment,
+	"payment":       StateApplyingPayment,
+	"review_totals": StateReviewingTotals,
+	"place_order":   StatePlacingOrder,
+}
+
+// RetryStage returns the stage a config key names.
+func RetryStage(name string) (State, bool) {
+	s, ok := retryStages[name]
+	return s, ok
+}
+
+// CanRelogin reports whether a stage may log in again and resume. The
+// login stage itself cannot, and placing an order never does: a rejected
+// session there is treated like any other PlaceOrder failure.
+func CanRelogin(s State) bool {
+	return s >= StateAddingToCart && s <= StateReviewingTotals
+}
+
+// DefaultRetryPolicies returns the per-stage policies used by NewWorker.
+// Adding to cart is retried hardest since that is where drops are won or
+// lost. Placing an order is only retried after LookupOrder confirms the
+// previous try did not go through.
+func DefaultRetryPolicies() map[State]RetryPolicy {
+	relogin := true
+	cartStage := RetryPolicy{
+		Attempts:   3,
+		Backoff:    models.Duration(250 * time.Millisecond),
+		MaxBackoff: models.Duration(time.Second),
+		Relogin:    &relogin,
+	}
+	return map[State]RetryPolicy{
+		StateLoggingIn: {Attempts: 2, Backoff: models.Duration(time.Second), MaxBackoff: models.Duration(time.Second)},
+		StateAddingToCart: {
+			Attempts:   5,
+			Backoff:    models.Duration(200 * time.Millisecond),
+			MaxBackoff: models.Duration(2 * time.Second),
+			Relogin:    &relogin,
+		},
+		StateVerifyingCart:        cartStage,
+		StateSelectingFulfillment: cartStage,
+		StateApplyingPayment:      cartStage,
+		StateReviewingTotals:      cartStage,
+		StatePlacingOrder:         {Attempts: 2, Backoff: models.Duration(500 * time.Millisecond), MaxBackoff: models.Duration(500 * time.Millisecond)},
+		StateConfirming:           {Attempts: 1},
+	}
+}
+
+// RetryConfig overrides retry policies from a config file, keyed by the
+// stage names accepted by RetryStage. Unset fields keep their defaults.
+type RetryConfig map[string]RetryPolicy
+
+// Policies returns the default policies with c applied.
+func (c RetryConfig) Policies() (map[State]RetryPolicy, error) {
+	policies := DefaultRetryPolicies()
+	for name, p := range c {
+		s, ok := RetryStage(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown retry stage %q", name)
+		}
+		policies[s] = p.merge(policies[s])
+	}
+	return policies, nil
+}
+
+// runStep runs s under the worker's retry policy for its state. It
+// returns the last error once the policy gives up.
+func (w *Worker) runStep(ctx context.Context, s step, a *attempt) error {
+	policy := w.Retry[s.state]
+	for try := 1; ; try++ {
+		stageCtx, cancel := w.stageContext(ctx, s.state)
+		err := s.run(w, stageCtx, a)
+		cancel()
+		if err == nil || ctx.Err() != nil {
+			return err
+		}
+
+		switch {
+		case errors.Is(err, ErrSessionExpired) && policy.ReloginEnabled() && CanRelogin(s.state) && !a.relogged:
+			a.relogged = true
+			log.Printf("[%s worker %d] %s: session expired, logging in again", w.Task.ID, w.ID, s.state)
+			if lerr := w.relogin(ctx, s.state, a); lerr != nil {
+				return fmt.Errorf("%w (re-login failed: %v)", err, lerr)
+			}
+			// The stage never reached Target, so the retry is free.
+			try--
+			continue
+		case s.state == StatePlacingOrder && ambiguous(err):
+			placed, lerr := w.lookupOrder(ctx, a)
+			if lerr != nil {
+				return fmt.Errorf("%w: %w (order lookup: %v)", ErrOrderUnknown, err, lerr)
+			}
+			if placed {
+				return nil
+			}
+		case !Transient(err):
+			return err
+		}
+
+		if try >= policy.Attempts {
+			return err
+		}
+		delay := policy.delay(try)
+		log.Printf("[%s worker %d] %s failed (try %d/%d), retrying in %s: %v",
+			w.Task.ID, w.ID, s.state, try, policy.Attempts, delay, err)
+		if serr := sleepCtx(ctx, delay); serr != nil {
+			return err
+		}
+	}
+}
+
+// relogin moves to StateLoggingIn, logs in and returns to from.
+func (w *Worker) relogin(ctx context.Context, from State, a *attempt) error {
+	if err := w.transition(StateLoggingIn); err != nil {
+		return err
+	}
+	a.result.Stage = StateLoggingIn
+	loginCtx, cancel := w.stageContext(ctx, StateLoggingIn)
+	err := w.Client.Login(loginCtx)
+	cancel()
+	if err != nil {
+		return err
+	}
+	if err := w.transition(from); err != nil {
+		return err
+	}
+	a.result.Stage = from
+	return nil
+}
+
+// lookupOrder asks the client whether the cart was already checked out.
+// It returns placed=true with the order ID recorded in the result, or an
+// error if that cannot be determined.
+func (w *Worker) lookupOrder(ctx context.Context, a *attempt) (bool, error) {
+	lookup, ok := w.Client.(OrderLookup)
+	if !ok {
+		return false, errors.New("client cannot look up orders")
+	}
+	lookupCtx, cancel := w.stageContext(ctx, StateConfirming)
+	defer cancel()
+	orderID, placed, err := lookup.LookupOrder(lookupCtx, OrderQuery{
+		CartID:   a.result.CartID,
+		TCIN:     a.result.Product.TCIN,
+		Quantity: a.result.Quantity,
+		Since:    a.started,
+		Claimed:  w.Claims.Claimed,
+	})
+	switch {
+	case err != nil:
+		return false, err
+	case placed && orderID == "":
+		return false, errors.New("cart was checked out but no single order matches it")
+	case placed && !w.Claims.Claim(orderID):
+		return false, fmt.Errorf("cart was checked out but order %s belongs to another attempt", orderID)
+	case placed:
+		log.Printf("[%s worker %d] order %s was placed despite the error", w.Task.ID, w.ID, orderID)
+		a.result.OrderID = orderID
+	default:
+		log.Printf("[%s worker %d] cart %s was not checked out", w.Task.ID, w.ID, a.result.CartID)
+	}
+	return placed, nil
+}
+
+// ambiguous reports whether a PlaceOrder error leaves the order's fate
+// unknown: the request may have reached Target before it failed. A 429 or
+// a 4xx is a definite rejection.
+func ambiguous(err error) bool {
+	return errors.Is(err, ErrTransient) || errors.Is(err, ErrServer) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// sleepCtx waits for d or until ctx is done.
+func sleepCtx(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
@@ -0,0 +1,266 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"zeng_bot/internal/models"
+)
+
+// fakeClient is a NoOpClient whose AddToCart and PlaceOrder fail from a
+// script and whose LookupOrder answers with lookup.
+type fakeClient struct {
+	NoOpClient
+
+	mu sync.Mutex
+	// atcErrs and placeErrs are returned by successive calls; calls past
+	// the end succeed.
+	atcErrs, placeErrs []error
+	atcCalls           int
+	placeCalls         int
+	logins             int
+	orderID            string
+	lookup             func(q OrderQuery) (string, bool, error)
+	lookups            []OrderQuery
+}
+
+func (c *fakeClient) Login(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.logins++
+	return nil
+}
+
+func (c *fakeClient) AddToCart(ctx context.Context, event models.StockEvent, quantity int, mode models.FulfillmentMode) (string, error) {
+	c.mu.Lock()
+	n := c.atcCalls
+	c.atcCalls++
+	c.mu.Unlock()
+	if n < len(c.atcErrs) && c.atcErrs[n] != nil {
+		return "", c.atcErrs[n]
+	}
+	return c.NoOpClient.AddToCart(ctx, event, quantity, mode)
+}
+
+func (c *fakeClient) PlaceOrder(ctx context.Context, cartID string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := c.placeCalls
+	c.placeCalls++
+	if n < len(c.placeErrs) && c.placeErrs[n] != nil {
+		return "", c.placeErrs[n]
+	}
+	return c.orderID, nil
+}
+
+func (c *fakeClient) LookupOrder(ctx context.Context, q OrderQuery) (string, bool, error) {
+	c.mu.Lock()
+	c.lookups = append(c.lookups, q)
+	c.mu.Unlock()
+	if c.lookup == nil {
+		return "", false, errors.New("unexpected lookup")
+	}
+	return c.lookup(q)
+}
+
+var _ OrderLookup = (*fakeClient)(nil)
+
+// timeout is a PlaceOrder error that leaves the order's fate unknown.
+var timeout = fmt.Errorf("place order request failed: %w", context.DeadlineExceeded)
+
+// newTestWorker returns a worker for one unit of a test product that
+// retries without waiting.
+func newTestWorker(client CheckoutClient) *Worker {
+	task := models.Task{ID: "test", Product: models.TargetProduct{TCIN: "12345678"}, Quantity: 1}
+	w := NewWorker(1, task, models.Profile{Name: "main"}, client)
+	for s, p := range w.Retry {
+		p.Backoff, p.MaxBackoff = 0, 0
+		w.Retry[s] = p
+	}
+	return w
+}
+
+// runWorker runs w for a fresh stock event of its product.
+func runWorker(t *testing.T, w *Worker) (Result, error) {
+	t.Helper()
+	return w.Run(context.Background(), models.StockEvent{Product: w.Task.Product, DetectedAt: time.Now()})
+}
+
+func TestPlaceOrderTimeoutFoundByLookup(t *testing.T) {
+	client := &fakeClient{
+		placeErrs: []error{timeout},
+		lookup: func(q OrderQuery) (string, bool, error) {
+			return "order-1", true, nil
+		},
+	}
+	w := newTestWorker(client)
+
+	result, err := runWorker(t, w)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if client.placeCalls != 1 {
+		t.Errorf("PlaceOrder called %d times, want 1", client.placeCalls)
+	}
+	if result.OrderID != "order-1" || result.State != StateSuccess {
+		t.Errorf("result = order %q, state %s; want order-1, %s", result.OrderID, result.State, StateSuccess)
+	}
+	if len(client.lookups) != 1 {
+		t.Fatalf("LookupOrder called %d times, want 1", len(client.lookups))
+	}
+	q := client.lookups[0]
+	if q.CartID != result.CartID || q.TCIN != "12345678" || q.Quantity != 1 || q.Since.IsZero() {
+		t.Errorf("lookup query = %+v, want the attempt's cart, TCIN, quantity and start", q)
+	}
+}
+
+func TestPlaceOrderLookupNotPlacedRetries(t *testing.T) {
+	client := &fakeClient{
+		placeErrs: []error{timeout},
+		orderID:   "order-2",
+		lookup: func(q OrderQuery) (string, bool, error) {
+			return "", false, nil
+		},
+	}
+	result, err := runWorker(t, newTestWorker(client))
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if client.placeCalls != 2 || result.OrderID != "order-2" {
+		t.Errorf("PlaceOrder called %d times for order %q, want 2 for order-2", client.placeCalls, result.OrderID)
+	}
+}
+
+func TestPlaceOrderLookupFailureStops(t *testing.T) {
+	tests := []struct {
+		name   string
+		lookup func(q OrderQuery) (string, bool, error)
+	}{
+		{"lookup error", func(q OrderQuery) (string, bool, error) {
+			return "", false, fmt.Errorf("order history: %w", ErrServer)
+		}},
+		{"placed without an ID", func(q OrderQuery) (string, bool, error) {
+			return "", true, nil
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &fakeClient{placeErrs: []error{timeout}, orderID: "order-2", lookup: tt.lookup}
+			result, err := runWorker(t, newTestWorker(client))
+			if !errors.Is(err, ErrOrderUnknown) {
+				t.Fatalf("Run = %v, want ErrOrderUnknown", err)
+			}
+			if client.placeCalls != 1 {
+				t.Errorf("PlaceOrder called %d times, want 1", client.placeCalls)
+			}
+			if !Fatal(err) || !result.OrderMayExist(err) {
+				t.Errorf("Fatal = %t, OrderMayExist = %t; want both true", Fatal(err), result.OrderMayExist(err))
+			}
+		})
+	}
+}
+
+func TestPlaceOrderRejectionIsNotLookedUp(t *testing.T) {
+	client := &fakeClient{placeErrs: []error{&APIError{Op: "checkout", Status: 400, Kind: ErrRejected}}}
+	_, err := runWorker(t, newTestWorker(client))
+	if !errors.Is(err, ErrRejected) {
+		t.Fatalf("Run = %v, want ErrRejected", err)
+	}
+	if client.placeCalls != 1 || len(client.lookups) != 0 {
+		t.Errorf("PlaceOrder called %d times and LookupOrder %d, want 1 and 0", client.placeCalls, len(client.lookups))
+	}
+}
+
+func TestOrderClaims(t *testing.T) {
+	c := NewOrderClaims()
+	if !c.Claim("order-1") {
+		t.Error("first Claim(order-1) = false")
+	}
+	if c.Claim("order-1") {
+		t.Error("second Claim(order-1) = true")
+	}
+	if !c.Claimed("order-1") || c.Claimed("order-2") {
+		t.Error("Claimed does not match the claims made")
+	}
+
+	var none *OrderClaims
+	if !none.Claim("order-1") || none.Claimed("order-1") {
+		t.Error("a nil OrderClaims should accept every claim and report none")
+	}
+}
+
+func TestLookupOrderClaimedByAnotherAttempt(t *testing.T) {
+	claims := NewOrderClaims()
+
+	first := newTestWorker(&fakeClient{orderID: "order-1"})
+	first.Claims = claims
+	if _, err := runWorker(t, first); err != nil {
+		t.Fatalf("first Run: %v", err)
+	}
+
+	// The second attempt's lookup finds the first attempt's order.
+	client := &fakeClient{
+		placeErrs: []error{timeout},
+		lookup: func(q OrderQuery) (string, bool, error) {
+			if !q.Claimed("order-1") {
+				t.Error("lookup query does not report order-1 as claimed")
+			}
+			return "order-1", true, nil
+		},
+	}
+	second := newTestWorker(client)
+	second.Claims = claims
+	result, err := runWorker(t, second)
+	if !errors.Is(err, ErrOrderUnknown) {
+		t.Fatalf("second Run = %v, want ErrOrderUnknown", err)
+	}
+	if result.OrderID != "" {
+		t.Errorf("second attempt took order %s", result.OrderID)
+	}
+	if client.placeCalls != 1 {
+		t.Errorf("PlaceOrder called %d times, want 1", client.placeCalls)
+	}
+}
+
+func TestReloginOnceOnSessionExpired(t *testing.T) {
+	expired := &APIError{Op: "ATC", Status: 401, Kind: ErrSessionExpired}
+	tests := []struct {
+		name      string
+		atcErrs   []error
+		wantErr   error
+		wantCalls int
+	}{
+		{"expired once", []error{expired}, nil, 2},
+		{"expired again", []error{expired, expired}, ErrSessionExpired, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &fakeClient{atcErrs: tt.atcErrs, orderID: "order-1"}
+			_, err := runWorker(t, newTestWorker(client))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Run = %v, want %v", err, tt.wantErr)
+			}
+			if client.logins != 1 {
+				t.Errorf("logged in %d times, want 1", client.logins)
+			}
+			if client.atcCalls != tt.wantCalls {
+				t.Errorf("AddToCart called %d times, want %d", client.atcCalls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestPlaceOrderSessionExpiredDoesNotRelogin(t *testing.T) {
+	client := &fakeClient{placeErrs: []error{&APIError{Op: "checkout", Status: 401, Kind: ErrSessionExpired}}}
+	_, err := runWorker(t, newTestWorker(client))
+	if !errors.Is(err, ErrSessionExpired) {
+		t.Fatalf("Run = %v, want ErrSessionExpired", err)
+	}
+	if client.logins != 0 || client.placeCalls != 1 {
+		t.Errorf("logged in %d times and placed %d orders, want 0 and 1", client.logins, client.placeCalls)
+	}
+}
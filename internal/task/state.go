@@ -7,10 +7,27 @@ type State int
 const (
 	// StateIdle means the worker is waiting for a stock event.
 	StateIdle State = iota
+	// StateLoggingIn means the worker is authenticating its session.
+	StateLoggingIn
 	// StateAddingToCart means the worker is sending the ATC request.
 	StateAddingToCart
-	// StateSubmittingPayment means the worker is submitting payment details.
-	StateSubmittingPayment
+	// StateVerifyingCart means the worker is checking the item landed in
+	// the cart.
+	StateVerifyingCart
+	// StateSelectingFulfillment means the worker is choosing shipping or
+	// pickup for the cart.
+	StateSelectingFulfillment
+	// StateApplyingPayment means the worker is attaching payment details
+	// to the cart.
+	StateApplyingPayment
+	// StateReviewingTotals means the worker is fetching the order totals
+	// before committing.
+	StateReviewingTotals
+	// StatePlacingOrder means the worker has submitted the order. The
+	// outcome is unknown until Target responds.
+	StatePlacingOrder
+	// StateConfirming means the worker is checking the placed order.
+	StateConfirming
 	// StateSuccess means the order was placed successfully.
 	StateSuccess
 	// StateFailed means the task encountered a terminal error.
@@ -22,10 +39,22 @@ func (s State) String() string {
 	switch s {
 	case StateIdle:
 		return "Idle"
+	case StateLoggingIn:
+		return "Logging In"
 	case StateAddingToCart:
 		return "Adding to Cart"
-	case StateSubmittingPayment:
-		return "Submitting Payment"
+	case StateVerifyingCart:
+		return "Verifying Cart"
+	case StateSelectingFulfillment:
+		return "Selecting Fulfillment"
+	case StateApplyingPayment:
+		return "Applying Payment"
+	case StateReviewingTotals:
+		return "Reviewing Totals"
+	case StatePlacingOrder:
+		return "Placing Order"
+	case StateConfirming:
+		return "Confirming"
 	case StateSuccess:
 		return "Success"
 	case StateFailed:
@@ -34,3 +63,14 @@ func (s State) String() string {
 		return "Unknown"
 	}
 }
+
+// Terminal reports whether s ends a checkout attempt.
+func (s State) Terminal() bool {
+	return s == StateSuccess || s == StateFailed
+}
+
+// OrderMayExist reports whether an attempt that stopped in s may have
+// placed an order, so its outcome must be checked before retrying.
+func (s State) OrderMayExist() bool {
+	return s == StatePlacingOrder || s == StateConfirming
+}
@@ -1,161 +1,630 @@
 package task
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"net/url"
+	"sync/atomic"
+	"time"
 
 	"zeng_bot/internal/models"
 	"zeng_bot/internal/session"
+	"zeng_bot/internal/validation"
 )
 
 const (
-	targetAPIKey   = "9f36aeafbe60771e321a7cc95a78140772ab3e96"
-	targetCartURL  = "https://carts.target.com/web_checkouts/v1/cart_items?field_groups=CART%2CCART_ITEMS%2CSUMMARY&key=" + targetAPIKey
-	targetOrderURL = "https://carts.target.com/web_checkouts/v1/checkout?key=" + targetAPIKey
+	targetAPIKey          = "9f36aeafbe60771e321a7cc95a78140772ab3e96"
+	targetCheckoutsURL    = "https://carts.target.com/web_checkouts/v1"
+	targetPaymentsURL     = "https://carts.target.com/checkout_payments/v1"
+	targetOrderHistoryURL = "https://api.target.com/guest_order_aggregations/v1/order_history"
+	targetWalletURL       = "https://api.target.com/guest_wallets/v1/payment_methods"
+	targetCancelOrderURL  = "https://api.target.com/guest_order_cancellations/v1/orders"
+	targetCartFieldGroups = "CART,CART_ITEMS,SUMMARY"
 )
 
 // TargetClient is the production CheckoutClient that makes real
 // API calls to Target using a TLS-spoofed Session.
 type TargetClient struct {
 	session   session.Session
+	profile   models.Profile
 	visitorID string
+	// loggedIn is read and cleared by concurrent order status requests.
+	loggedIn atomic.Bool
+	// wallet is the wallet card applied to the current cart, kept to
+	// answer a CVV challenge when the order is placed.
+	wallet walletPayment
+	// giftCards are the gift cards already applied to giftCartID, by
+	// number, so a retried payment stage does not apply them twice.
+	giftCartID string
+	giftCards  map[string]models.PaymentInstruction
+}
+
+// walletPayment records a wallet card's payment instruction.
+type walletPayment struct {
+	cartID        string
+	instructionID string
+	cvv           string
 }
 
 // NewTargetClient creates a TargetClient backed by the given Session.
 // It runs WarmUp to populate cookies and visitorId, then logs in with
-// the account credentials from the provided Profile.
-func NewTargetClient(sess *session.TargetSession, profile models.Profile) (*TargetClient, error) {
-	if err := sess.WarmUp(); err != nil {
+// the account credentials from the provided Profile so that workers are
+// authenticated before the drop. ctx bounds both steps, including the
+// browser login.
+func NewTargetClient(ctx context.Context, sess *session.TargetSession, profile models.Profile) (*TargetClient, error) {
+	if err := sess.WarmUp(ctx); err != nil {
 		return nil, fmt.Errorf("failed to warm up session: %w", err)
 	}
 
-	if err := sess.Login(profile.Email, profile.Password); err != nil {
-		return nil, fmt.Errorf("failed to log in: %w", err)
+	c := &TargetClient{
+		session:   sess,
+		profile:   profile,
+		visitorID: sess.VisitorID,
+	}
+	if err := c.Login(ctx); err != nil {
+		return nil, err
 	}
+	return c, nil
+}
 
-	return &TargetClient{
+// ResumeTargetClient creates a TargetClient for a session restored from a
+// saved snapshot. It skips WarmUp and Login and assumes the session is
+// logged in; a request that finds it expired marks it logged out, and the
+// caller can Login then.
+func ResumeTargetClient(sess *session.TargetSession, profile models.Profile) *TargetClient {
+	c := &TargetClient{
 		session:   sess,
+		profile:   profile,
 		visitorID: sess.VisitorID,
-	}, nil
+	}
+	c.loggedIn.Store(true)
+	return c
+}
+
+// LoggedIn reports whether Login has succeeded on this session.
+func (c *TargetClient) LoggedIn() bool {
+	return c.loggedIn.Load()
+}
+
+// Login authenticates the session with the profile's credentials.
+func (c *TargetClient) Login(ctx context.Context) error {
+	if err := c.session.Login(ctx, c.profile.Email, c.profile.Password); err != nil {
+		c.loggedIn.Store(false)
+		return fmt.Errorf("failed to log in: %w", err)
+	}
+	c.loggedIn.Store(true)
+	return nil
 }
 
 // AddToCart sends a POST to Target's cart API for the given stock event.
-func (c *TargetClient) AddToCart(event models.StockEvent) (string, error) {
+func (c *TargetClient) AddToCart(ctx context.Context, event models.StockEvent, quantity int, mode models.FulfillmentMode) (string, error) {
 	payload := models.ATCRequest{
 		CartItem: models.ATCCartItem{
 			TCIN:          event.Product.TCIN,
-			Quantity:      1,
+			Quantity:      quantity,
 			ItemChannelID: "10",
 		},
 		CartType:        "REGULAR",
 		ChannelID:       "10",
 		ShoppingContext: "DIGITAL",
 	}
+	if mode.IsPickup() {
+		payload.Fulfillment = &models.CartItemFulfillment{Type: mode.CartType(), LocationID: event.Product.StoreID}
+	}
 
-	body, err := json.Marshal(payload)
-	if err != nil {
-		return "", fmt.Errorf("failed to marshal ATC payload: %w", err)
+	log.Printf("[target-client] ATC request for %d x TCIN %s (%s)", quantity, event.Product.TCIN, mode)
+	var atcResp models.Cart
+	reqURL := checkoutsURL("cart_items", url.Values{"field_groups": {targetCartFieldGroups}})
+	if err := c.call(ctx, "ATC", "POST", reqURL, payload, &atcResp); err != nil {
+		return "", err
+	}
+	if atcResp.CartID == "" {
+		return "", fmt.Errorf("ATC response missing cart_id")
 	}
 
-	headers := models.DefaultHeaders()
-	headers["Content-Type"] = "application/json"
-	headers["Accept"] = "application/json"
-	headers["Origin"] = "https://www.target.com"
-	headers["Referer"] = "https://www.target.com/"
-	headers["x-application-name"] = "web"
-	if c.visitorID != "" {
-		headers["x-visitor-id"] = c.visitorID
+	for _, item := range atcResp.CartItems {
+		if item.TCIN == event.Product.TCIN && item.Quantity < quantity {
+			log.Printf("[target-client] ATC accepted %d of %d for TCIN %s", item.Quantity, quantity, event.Product.TCIN)
+		}
 	}
+	log.Printf("[target-client] ATC success, cartID=%s", atcResp.CartID)
+	return atcResp.CartID, nil
+}
+
+// GetCart fetches the account's regular cart.
+func (c *TargetClient) GetCart(ctx context.Context) (models.Cart, error) {
+	var cart models.Cart
+	reqURL := checkoutsURL("cart_views", url.Values{
+		"cart_type":    {"REGULAR"},
+		"field_groups": {targetCartFieldGroups},
+	})
+	err := c.call(ctx, "cart view", "GET", reqURL, nil, &cart)
+	return cart, err
+}
 
-	log.Printf("[target-client] ATC request for TCIN %s", event.Product.TCIN)
-	log.Printf("[target-client] ATC body: %s", string(body))
+// RemoveItem deletes a line from the cart.
+func (c *TargetClient) RemoveItem(ctx context.Context, cartItemID string) (models.Cart, error) {
+	var cart models.Cart
+	reqURL := checkoutsURL("cart_items/"+url.PathEscape(cartItemID), url.Values{
+		"cart_type":    {"REGULAR"},
+		"field_groups": {targetCartFieldGroups},
+	})
+	log.Printf("[target-client] removing cart item %s", cartItemID)
+	err := c.call(ctx, "remove item", "DELETE", reqURL, nil, &cart)
+	return cart, err
+}
 
-	status, respBody, err := c.session.Do("POST", targetCartURL, headers, body)
+// UpdateQuantity sets a cart line's quantity. Target needs the line's
+// TCIN in the payload, so the cart is fetched first.
+func (c *TargetClient) UpdateQuantity(ctx context.Context, cartItemID string, quantity int) (models.Cart, error) {
+	cart, err := c.GetCart(ctx)
 	if err != nil {
-		return "", fmt.Errorf("ATC request failed: %w", err)
+		return cart, err
+	}
+	tcin := ""
+	for _, item := range cart.CartItems {
+		if item.CartItemID == cartItemID {
+			tcin = item.TCIN
+		}
+	}
+	if tcin == "" {
+		return cart, fmt.Errorf("cart item %s not found in cart %s", cartItemID, cart.CartID)
 	}
 
-	log.Printf("[target-client] ATC response status=%d body=%s", status, string(respBody))
+	payload := models.UpdateCartItemRequest{
+		CartItem: models.UpdateCartItem{TCIN: tcin, Quantity: quantity},
+		CartType: "REGULAR",
+	}
+	reqURL := checkoutsURL("cart_items/"+url.PathEscape(cartItemID), url.Values{"field_groups": {targetCartFieldGroups}})
+	log.Printf("[target-client] setting cart item %s (TCIN %s) to quantity %d", cartItemID, tcin, quantity)
+	cart = models.Cart{}
+	err = c.call(ctx, "update quantity", "PUT", reqURL, payload, &cart)
+	return cart, err
+}
 
-	if status < 200 || status >= 300 {
-		return "", fmt.Errorf("ATC returned status %d: %s", status, string(respBody))
+// ClearCart removes every line from the cart one at a time.
+func (c *TargetClient) ClearCart(ctx context.Context) error {
+	cart, err := c.GetCart(ctx)
+	if err != nil {
+		return err
 	}
+	for _, item := range cart.CartItems {
+		if _, err := c.RemoveItem(ctx, item.CartItemID); err != nil {
+			return fmt.Errorf("failed to clear cart %s: %w", cart.CartID, err)
+		}
+	}
+	return nil
+}
 
-	var atcResp models.ATCResponse
-	if err := json.Unmarshal(respBody, &atcResp); err != nil {
-		return "", fmt.Errorf("failed to parse ATC response: %w", err)
+// SelectFulfillment sets the cart's shipping address, or for pickup and
+// drive-up makes sure the task's line is collected at its store.
+func (c *TargetClient) SelectFulfillment(ctx context.Context, cartID string, task models.Task, profile models.Profile) (models.CartItemFulfillment, error) {
+	if task.Fulfillment.IsPickup() {
+		return c.selectPickup(ctx, task)
 	}
+	payload := models.ShippingAddressRequest{
+		CartID:   cartID,
+		CartType: "REGULAR",
+		Address:  models.NewCheckoutAddress(profile, profile.Shipping),
+		Selected: true,
+	}
+	err := c.call(ctx, "shipping address", "POST", checkoutsURL("cart_shipping_addresses", nil), payload, nil)
+	return models.CartItemFulfillment{Type: task.Fulfillment.CartType()}, err
+}
 
-	if atcResp.CartID == "" {
-		return "", fmt.Errorf("ATC response missing cart_id: %s", string(respBody))
+// selectPickup moves the task's cart line to pickup at the task's store
+// unless ATC already put it there.
+func (c *TargetClient) selectPickup(ctx context.Context, task models.Task) (models.CartItemFulfillment, error) {
+	want := models.CartItemFulfillment{Type: task.Fulfillment.CartType(), LocationID: task.Product.StoreID}
+	cart, err := c.GetCart(ctx)
+	if err != nil {
+		return models.CartItemFulfillment{}, err
+	}
+	item, ok := cart.Item(task.Product.TCIN)
+	if !ok {
+		return models.CartItemFulfillment{}, fmt.Errorf("TCIN %s not found in cart %s: %w", task.Product.TCIN, cart.CartID, ErrOutOfStock)
+	}
+	if item.Fulfillment.Type == want.Type && item.Fulfillment.LocationID == want.LocationID {
+		return item.Fulfillment, nil
 	}
 
-	log.Printf("[target-client] ATC success, cartID=%s", atcResp.CartID)
-	return atcResp.CartID, nil
+	payload := models.UpdateCartItemRequest{
+		CartItem: models.UpdateCartItem{TCIN: item.TCIN, Quantity: item.Quantity, Fulfillment: &want},
+		CartType: "REGULAR",
+	}
+	reqURL := checkoutsURL("cart_items/"+url.PathEscape(item.CartItemID), url.Values{"field_groups": {targetCartFieldGroups}})
+	log.Printf("[target-client] moving TCIN %s to %s at store %s", item.TCIN, want.Type, want.LocationID)
+	cart = models.Cart{}
+	if err := c.call(ctx, "pickup store", "PUT", reqURL, payload, &cart); err != nil {
+		return models.CartItemFulfillment{}, err
+	}
+	item, ok = cart.Item(task.Product.TCIN)
+	if !ok || item.Fulfillment.Type != want.Type || item.Fulfillment.LocationID != want.LocationID {
+		return models.CartItemFulfillment{}, fmt.Errorf("store %s did not accept TCIN %s for %s: %w",
+			want.LocationID, task.Product.TCIN, task.Fulfillment, ErrOutOfStock)
+	}
+	return item.Fulfillment, nil
+}
+
+// ApplyPayment applies the profile's gift cards in order and then its
+// card for the rest. The card is skipped if the gift cards cover the
+// order. A saved card is used when the wallet has it; otherwise the card
+// is entered in full if the profile has one.
+func (c *TargetClient) ApplyPayment(ctx context.Context, cartID string, profile models.Profile) ([]models.Tender, error) {
+	c.wallet = walletPayment{}
+	if c.giftCartID != cartID {
+		c.giftCartID, c.giftCards = cartID, make(map[string]models.PaymentInstruction)
+	}
+
+	var tenders []models.Tender
+	for _, gc := range profile.GiftCards {
+		instruction, err := c.applyGiftCard(ctx, cartID, gc)
+		if err != nil {
+			return tenders, fmt.Errorf("%s: %w", gc.Masked(), err)
+		}
+		tenders = append(tenders, models.Tender{Type: models.TenderGiftCard, Last4: gc.Last4(), Amount: instruction.Amount})
+		if instruction.Amount > 0 && instruction.BalanceDue <= 0 {
+			log.Printf("[target-client] gift cards cover cart %s", cartID)
+			return tenders, nil
+		}
+		if !profile.Payment.HasCard() && len(tenders) == len(profile.GiftCards) {
+			return tenders, fmt.Errorf("gift cards leave %s due and the profile has no card: %w",
+				instruction.BalanceDue, ErrPaymentDeclined)
+		}
+	}
+
+	card, err := c.applyCard(ctx, cartID, profile)
+	if err != nil {
+		return tenders, err
+	}
+	return append(tenders, card), nil
 }
 
-// SubmitPayment sends a POST to Target's checkout API to finalize the order.
-func (c *TargetClient) SubmitPayment(cartID string, profile models.Profile) (string, error) {
-	payload := models.OrderRequest{
+// applyGiftCard applies one gift card, unless it already is.
+func (c *TargetClient) applyGiftCard(ctx context.Context, cartID string, gc models.GiftCard) (models.PaymentInstruction, error) {
+	if instruction, ok := c.giftCards[gc.Number]; ok {
+		return instruction, nil
+	}
+	payload := models.PaymentInstructionRequest{
 		CartID:          cartID,
-		ShippingAddress: profile.Shipping,
-		BillingAddress:  profile.Billing,
-		PaymentInfo: models.OrderPayment{
-			CardNumber: profile.Payment.CardNumber,
+		WalletMode:      "NONE",
+		PaymentType:     "GIFT_CARD",
+		GiftCardDetails: &models.GiftCardDetails{CardNumber: gc.Number, PIN: gc.PIN},
+	}
+	log.Printf("[target-client] applying %s to cart %s", gc.Masked(), cartID)
+	var instruction models.PaymentInstruction
+	if err := c.call(ctx, "gift card", "POST", paymentsURL("payment_instructions"), payload, &instruction); err != nil {
+		return models.PaymentInstruction{}, err
+	}
+	c.giftCards[gc.Number] = instruction
+	return instruction, nil
+}
+
+// applyCard attaches the profile's card, saved or entered.
+func (c *TargetClient) applyCard(ctx context.Context, cartID string, profile models.Profile) (models.Tender, error) {
+	if saved := profile.Payment.SavedCard; saved != "" {
+		method, err := c.savedCard(ctx, saved)
+		switch {
+		case err == nil:
+			instruction, err := c.applySavedCard(ctx, cartID, profile, method)
+			return models.Tender{Type: models.TenderCard, Last4: method.Last4, Amount: instruction.Amount}, err
+		case !errors.Is(err, ErrNoSavedCard) || profile.Payment.CardNumber == "":
+			return models.Tender{}, err
+		}
+		log.Printf("[target-client] %v, entering card %s instead", err, profile.Payment.Masked())
+	}
+
+	billing := models.NewCheckoutAddress(profile, profile.Billing)
+	payload := models.PaymentInstructionRequest{
+		CartID:      cartID,
+		WalletMode:  "NONE",
+		PaymentType: "CARD",
+		CardDetails: &models.OrderPayment{
+			CardNumber: validation.CardDigits(profile.Payment.CardNumber),
 			ExpMonth:   profile.Payment.ExpMonth,
 			ExpYear:    profile.Payment.ExpYear,
 			CVV:        profile.Payment.CVV,
-			CardType:   "VISA",
-		},
-		ContactInfo: models.OrderContact{
-			Name:  profile.Name,
-			Email: profile.Email,
-			Phone: profile.Phone,
+			CardType:   validation.DetectBrand(profile.Payment.CardNumber).TargetCardType(),
 		},
+		BillingAddress: &billing,
 	}
-
-	body, err := json.Marshal(payload)
-	if err != nil {
-		return "", fmt.Errorf("failed to marshal order payload: %w", err)
+	log.Printf("[target-client] applying payment to cart %s", cartID)
+	var instruction models.PaymentInstruction
+	if err := c.call(ctx, "payment", "POST", paymentsURL("payment_instructions"), payload, &instruction); err != nil {
+		return models.Tender{}, err
 	}
+	return models.Tender{Type: models.TenderCard, Last4: profile.Payment.Last4(), Amount: instruction.Amount}, nil
+}
 
-	headers := models.DefaultHeaders()
-	headers["Content-Type"] = "application/json"
-	headers["Accept"] = "application/json"
-	headers["Origin"] = "https://www.target.com"
-	headers["Referer"] = "https://www.target.com/"
-	headers["x-application-name"] = "web"
-	headers["x-api-key"] = targetAPIKey
-	if c.visitorID != "" {
-		headers["x-visitor-id"] = c.visitorID
+// GiftCardBalance looks up what is left on a gift card.
+func (c *TargetClient) GiftCardBalance(ctx context.Context, card models.GiftCard) (models.Money, error) {
+	var balance models.GiftCardBalance
+	payload := models.GiftCardDetails{CardNumber: card.Number, PIN: card.PIN}
+	if err := c.call(ctx, "gift card balance", "POST", paymentsURL("gift_card_balance"), payload, &balance); err != nil {
+		return 0, err
 	}
+	return balance.Balance, nil
+}
 
-	log.Printf("[target-client] submitting payment for cart %s", cartID)
+// PaymentMethods lists the cards saved in the account's wallet.
+func (c *TargetClient) PaymentMethods(ctx context.Context) ([]models.SavedPaymentMethod, error) {
+	var wallet models.Wallet
+	reqURL := targetWalletURL + "?key=" + targetAPIKey
+	if err := c.call(ctx, "wallet", "GET", reqURL, nil, &wallet); err != nil {
+		return nil, err
+	}
+	return wallet.PaymentMethods, nil
+}
 
-	status, respBody, err := c.session.Do("POST", targetOrderURL, headers, body)
+// savedCard finds the wallet card named by key.
+func (c *TargetClient) savedCard(ctx context.Context, key string) (models.SavedPaymentMethod, error) {
+	methods, err := c.PaymentMethods(ctx)
 	if err != nil {
-		return "", fmt.Errorf("order request failed: %w", err)
+		return models.SavedPaymentMethod{}, err
 	}
+	method, ok := models.Wallet{PaymentMethods: methods}.Find(key)
+	if !ok {
+		return models.SavedPaymentMethod{}, fmt.Errorf("no unexpired card %q among %d in the wallet: %w", key, len(methods), ErrNoSavedCard)
+	}
+	return method, nil
+}
 
-	log.Printf("[target-client] order response status=%d body=%s", status, string(respBody))
+// applySavedCard attaches a wallet card by ID, answering a CVV challenge
+// straight away if Target asks for one.
+func (c *TargetClient) applySavedCard(ctx context.Context, cartID string, profile models.Profile, method models.SavedPaymentMethod) (models.PaymentInstruction, error) {
+	payload := models.PaymentInstructionRequest{
+		CartID:      cartID,
+		WalletMode:  "EXISTING",
+		PaymentType: "CARD",
+		WalletID:    method.WalletID,
+	}
+	log.Printf("[target-client] applying saved %s card **** %s to cart %s", method.CardType, method.Last4, cartID)
+	var instruction models.PaymentInstruction
+	if err := c.call(ctx, "payment", "POST", paymentsURL("payment_instructions"), payload, &instruction); err != nil {
+		return models.PaymentInstruction{}, err
+	}
+	c.wallet = walletPayment{cartID: cartID, instructionID: instruction.PaymentInstructionID, cvv: profile.Payment.CVV}
+	if instruction.CVVRequired {
+		return instruction, c.answerCVV(ctx)
+	}
+	return instruction, nil
+}
 
-	if status < 200 || status >= 300 {
-		return "", fmt.Errorf("order returned status %d: %s", status, string(respBody))
+// answerCVV sends the CVV for the wallet card applied to the cart.
+func (c *TargetClient) answerCVV(ctx context.Context) error {
+	switch {
+	case c.wallet.instructionID == "":
+		return fmt.Errorf("CVV challenge without a saved card payment: %w", ErrCVVRequired)
+	case c.wallet.cvv == "":
+		return fmt.Errorf("profile has no cvv for its saved card: %w", ErrCVVRequired)
 	}
+	payload := models.CVVChallengeRequest{
+		CartID:      c.wallet.cartID,
+		WalletMode:  "EXISTING",
+		PaymentType: "CARD",
+		CardDetails: models.CVVDetails{CVV: c.wallet.cvv},
+	}
+	log.Printf("[target-client] answering CVV challenge for cart %s", c.wallet.cartID)
+	return c.call(ctx, "cvv", "PUT", paymentsURL("payment_instructions/"+url.PathEscape(c.wallet.instructionID)), payload, nil)
+}
 
-	var orderResp models.OrderResponse
-	if err := json.Unmarshal(respBody, &orderResp); err != nil {
-		return "", fmt.Errorf("failed to parse order response: %w", err)
+// ReviewTotals fetches the pre-checkout cart, which carries the final
+// totals.
+func (c *TargetClient) ReviewTotals(ctx context.Context, cartID string) (models.CartSummary, error) {
+	reqURL := checkoutsURL("pre_checkout", url.Values{
+		"cart_type":    {"REGULAR"},
+		"field_groups": {"ADDRESSES,CART,CART_ITEMS,FINANCE_PROVIDERS,PAYMENT_INSTRUCTIONS,SUMMARY"},
+	})
+	var cart models.Cart
+	if err := c.call(ctx, "pre-checkout", "GET", reqURL, nil, &cart); err != nil {
+		return models.CartSummary{}, err
+	}
+	// A zero total would pass any price limit, so never report one.
+	if cart.Summary.GrandTotal <= 0 {
+		return models.CartSummary{}, fmt.Errorf("pre-checkout response for cart %s has no grand total", cartID)
 	}
+	log.Printf("[target-client] cart %s totals: items %s, shipping %s, tax %s, total %s", cartID,
+		cart.Summary.ProductTotal, cart.Summary.Shipping, cart.Summary.Tax, cart.Summary.GrandTotal)
+	return cart.Summary, nil
+}
+
+// PlaceOrder submits the cart as an order.
+func (c *TargetClient) PlaceOrder(ctx context.Context, cartID string) (string, error) {
+	payload := models.PlaceOrderRequest{CartType: "REGULAR", ChannelID: "10"}
 
+	log.Printf("[target-client] placing order for cart %s", cartID)
+	var orderResp models.OrderResponse
+	err := c.call(ctx, "order", "POST", checkoutsURL("checkout", nil), payload, &orderResp)
+	if errors.Is(err, ErrCVVRequired) && c.wallet.cartID == cartID {
+		// A CVV challenge is a definite rejection, so the order can be
+		// submitted again once it is answered.
+		if err := c.answerCVV(ctx); err != nil {
+			return "", err
+		}
+		err = c.call(ctx, "order", "POST", checkoutsURL("checkout", nil), payload, &orderResp)
+	}
+	if err != nil {
+		return "", err
+	}
 	if orderResp.OrderID == "" {
-		return "", fmt.Errorf("order response missing order_id: %s", string(respBody))
+		return "", fmt.Errorf("order response missing order_id")
 	}
 
 	log.Printf("[target-client] order success, orderID=%s", orderResp.OrderID)
 	return orderResp.OrderID, nil
 }
 
+// ConfirmOrder checks that the order shows up in the account's history.
+func (c *TargetClient) ConfirmOrder(ctx context.Context, orderID string) error {
+	return c.call(ctx, "order lookup", "GET", orderDetailsURL(orderID), nil, nil)
+}
+
+// OrderStatus fetches the order's details and returns its status.
+func (c *TargetClient) OrderStatus(ctx context.Context, orderID string) (models.OrderStatus, error) {
+	var details models.OrderDetails
+	if err := c.call(ctx, "order status", "GET", orderDetailsURL(orderID), nil, &details); err != nil {
+		return "", err
+	}
+	status, ok := details.Status()
+	if !ok {
+		return "", fmt.Errorf("order %s has no known status (order_status %q)", orderID, details.OrderStatus)
+	}
+	return status, nil
+}
+
+// CancelOrder asks Target to cancel the order with reason as the cancel
+// reason code.
+func (c *TargetClient) CancelOrder(ctx context.Context, orderID, reason string) (models.OrderStatus, error) {
+	payload := models.CancelOrderRequest{OrderNumber: orderID, ReasonCode: reason}
+	reqURL := targetCancelOrderURL + "/" + url.PathEscape(orderID) + "?key=" + targetAPIKey
+
+	log.Printf("[target-client] cancelling order %s", orderID)
+	var details models.OrderDetails
+	if err := c.call(ctx, "cancel order", "POST", reqURL, payload, &details); err != nil {
+		return "", err
+	}
+	status, _ := details.Status()
+	return status, nil
+}
+
+// LookupOrder checks whether the attempt's cart was checked out after an
+// ambiguous PlaceOrder failure. A cart that still holds the item was not
+// ordered. Otherwise the attempt's order is the one unclaimed order placed
+// since then with a line for its TCIN and quantity; if none or several
+// match, the order is reported placed with no ID.
+func (c *TargetClient) LookupOrder(ctx context.Context, q OrderQuery) (string, bool, error) {
+	cart, err := c.GetCart(ctx)
+	if err != nil {
+		return "", false, err
+	}
+	if _, ok := cart.Item(q.TCIN); ok && cart.CartID == q.CartID {
+		return "", false, nil
+	}
+
+	var history models.OrderHistory
+	reqURL := targetOrderHistoryURL + "?" + url.Values{
+		"page_number": {"1"},
+		"page_size":   {"10"},
+		"key":         {targetAPIKey},
+	}.Encode()
+	if err := c.call(ctx, "order history", "GET", reqURL, nil, &history); err != nil {
+		return "", true, err
+	}
+	var matches []string
+	for _, o := range history.Orders {
+		// Allow for clock skew between us and Target.
+		if o.PlacedDate.Before(q.Since.Add(-time.Minute)) {
+			continue
+		}
+		if q.Claimed != nil && q.Claimed(o.OrderNumber) {
+			continue
+		}
+		if len(o.OrderLines) == 0 {
+			// The history omits lines for some orders; the details have
+			// them.
+			var details models.OrderDetails
+			if err := c.call(ctx, "order lookup", "GET", orderDetailsURL(o.OrderNumber), nil, &details); err != nil {
+				return "", true, err
+			}
+			o.OrderLines = details.OrderLines
+		}
+		if o.Contains(q.TCIN, q.Quantity) {
+			matches = append(matches, o.OrderNumber)
+		}
+	}
+	if len(matches) != 1 {
+		log.Printf("[target-client] %d orders since %s match TCIN %s x %d", len(matches),
+			q.Since.Format(time.TimeOnly), q.TCIN, q.Quantity)
+		return "", true, nil
+	}
+	return matches[0], true, nil
+}
+
+// call sends payload (if non-nil) as JSON and decodes a 2xx response into
+// out (if non-nil). name labels the request in logs and errors.
+func (c *TargetClient) call(ctx context.Context, name, method, reqURL string, payload, out interface{}) error {
+	var body []byte
+	if payload != nil {
+		var err error
+		body, err = json.Marshal(payload)
+		if err != nil {
+			return fmt.Errorf("failed to marshal %s payload: %w", name, err)
+		}
+		log.Printf("[target-client] %s body: %s", name, string(body))
+	}
+
+	status, respBody, err := c.session.Do(ctx, method, reqURL, c.headers(payload != nil), body)
+	if err != nil {
+		if ctx.Err() != nil {
+			return fmt.Errorf("%s request failed: %w", name, err)
+		}
+		return fmt.Errorf("%s request failed: %w: %w", name, ErrTransient, err)
+	}
+
+	log.Printf("[target-client] %s response status=%d body=%s", name, status, string(respBody))
+
+	if status < 200 || status >= 300 {
+		apiErr := ParseAPIError(name, status, respBody)
+		if errors.Is(apiErr, ErrSessionExpired) {
+			// Make the next attempt log in again rather than reuse the
+			// dead session.
+			c.loggedIn.Store(false)
+		}
+		return apiErr
+	}
+	if out != nil {
+		if err := json.Unmarshal(respBody, out); err != nil {
+			return fmt.Errorf("failed to parse %s response: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// headers returns the headers for a checkout API request.
+func (c *TargetClient) headers(hasBody bool) map[string]string {
+	headers := models.DefaultHeaders()
+	if hasBody {
+		headers["Content-Type"] = "application/json"
+	}
+	headers["Accept"] = "application/json"
+	headers["Origin"] = "https://www.target.com"
+	headers["Referer"] = "https://www.target.com/"
+	headers["x-application-name"] = "web"
+	headers["x-api-key"] = targetAPIKey
+	if c.visitorID != "" {
+		headers["x-visitor-id"] = c.visitorID
+	}
+	return headers
+}
+
+// checkoutsURL builds a web_checkouts endpoint URL with the API key.
+func checkoutsURL(path string, query url.Values) string {
+	q := url.Values{}
+	for k, v := range query {
+		q[k] = v
+	}
+	q.Set("key", targetAPIKey)
+	return targetCheckoutsURL + "/" + path + "?" + q.Encode()
+}
+
+// orderDetailsURL returns the order details API URL for orderID.
+func orderDetailsURL(orderID string) string {
+	return targetOrderHistoryURL + "/" + url.PathEscape(orderID) + "?key=" + targetAPIKey
+}
+
+// paymentsURL returns a checkout payments API URL for path.
+func paymentsURL(path string) string {
+	return targetPaymentsURL + "/" + path + "?key=" + targetAPIKey
+}
+
 // compile-time check: TargetClient must satisfy CheckoutClient.
-var _ CheckoutClient = (*TargetClient)(nil)
+var (
+	_ CheckoutClient = (*TargetClient)(nil)
+	_ OrderLookup    = (*TargetClient)(nil)
+	_ BalanceChecker = (*TargetClient)(nil)
+	_ StatusChecker  = (*TargetClient)(nil)
+	_ OrderCanceller = (*TargetClient)(nil)
+)
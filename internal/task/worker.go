@@ -1,57 +1,526 @@
 package task
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
+	"strings"
+	"time"
 
+	"zeng_bot/internal/budget"
 	"zeng_bot/internal/models"
 )
 
+// DefaultMaxEventAge is how long after detection a stock event is still
+// worth acting on. Older events most likely describe stock that has
+// already sold out again.
+const DefaultMaxEventAge = 30 * time.Second
+
+// ErrStaleEvent is returned by Run for events older than MaxEventAge.
+// No checkout is attempted.
+var ErrStaleEvent = errors.New("stale stock event")
+
+// ErrUnavailable is returned by Run for events whose stock is not
+// available with the task's fulfillment mode, e.g. shipping-only stock
+// for a pickup task. No checkout is attempted.
+var ErrUnavailable = errors.New("not in stock for this fulfillment")
+
 // Worker represents a single checkout worker that listens for stock events
-// and executes the checkout state machine.
+// and executes the checkout state machine for its task.
 type Worker struct {
 	ID      int
+	Task    models.Task
 	Profile models.Profile
 	Client  CheckoutClient
-	State   State
+
+	machine *Machine
+
+	// StageTimeouts bounds how long each checkout stage may take. A stage
+	// without an entry is bounded only by the context passed to Run.
+	StageTimeouts map[State]time.Duration
+
+	// MaxEventAge is the oldest event Run will act on, measured from
+	// StockEvent.DetectedAt. Zero disables the check.
+	MaxEventAge time.Duration
+
+	// Retry holds each stage's retry policy. A stage without an entry is
+	// tried once.
+	Retry map[State]RetryPolicy
+
+	// Budget, if set, must have room for the order total before the
+	// order is placed.
+	Budget *budget.Ledger
+
+	// Claims, if set, is shared by every worker of a run so an order
+	// found after an ambiguous PlaceOrder is attributed to one attempt.
+	Claims *OrderClaims
+
+	// SharedTCINs are the products of other tasks running on the same
+	// account. Tasks on one account share its cart, so their lines are
+	// left alone whatever the UnrelatedItems policy.
+	SharedTCINs map[string]bool
 }
 
-// NewWorker creates a worker with the given ID, profile, and client.
-func NewWorker(id int, profile models.Profile, client CheckoutClient) *Worker {
-	return &Worker{
+// DefaultStageTimeouts returns the per-stage deadlines used by NewWorker.
+// Login may open a browser, and placing the order gets a long budget
+// because abandoning it early leaves the order outcome unknown.
+func DefaultStageTimeouts() map[State]time.Duration {
+	return map[State]time.Duration{
+		StateLoggingIn:            2 * time.Minute,
+		StateAddingToCart:         10 * time.Second,
+		StateVerifyingCart:        10 * time.Second,
+		StateSelectingFulfillment: 10 * time.Second,
+		StateApplyingPayment:      15 * time.Second,
+		StateReviewingTotals:      10 * time.Second,
+		StatePlacingOrder:         30 * time.Second,
+		StateConfirming:           15 * time.Second,
+	}
+}
+
+// Result describes the outcome of a single checkout attempt. State is
+// the state the worker finished in and Stage is the last stage it entered
+// before finishing, so a failed attempt records where it stopped. CartID
+// and OrderID are set as far as the attempt got.
+type Result struct {
+	TaskID   string
+	WorkerID int
+	Profile  string
+	Product  models.TargetProduct
+	CartID   string
+	OrderID  string
+	State    State
+	Stage    State
+
+	// Requested is the task's quantity and Quantity how many units the
+	// cart held once verified.
+	Requested int
+	Quantity  int
+	// UnitPrice and Totals are what Target charged, as far as the
+	// attempt got.
+	UnitPrice models.Money
+	Totals    models.CartSummary
+
+	// Fulfillment is the task's mode. For pickup and drive-up,
+	// PickupStoreID and PickupStoreName are the store Target accepted.
+	Fulfillment     models.FulfillmentMode
+	PickupStoreID   string
+	PickupStoreName string
+
+	// Tenders is how the order was paid: gift cards in the order they
+	// were applied, then the card that covered the rest.
+	Tenders []models.Tender
+}
+
+// Partial reports whether the cart held fewer units than the task asked
+// for, e.g. because of a purchase limit.
+func (r Result) Partial() bool {
+	return r.Quantity > 0 && r.Quantity < r.Requested
+}
+
+// OrderMayExist reports whether the attempt that ended with r and err
+// placed an order or may have: it succeeded, got an order ID, or stopped
+// while placing the order without learning the outcome.
+func (r Result) OrderMayExist(err error) bool {
+	return err == nil || r.OrderID != "" || errors.Is(err, ErrOrderUnknown) ||
+		(r.Stage.OrderMayExist() && errors.Is(err, context.Canceled))
+}
+
+// NewWorker creates a worker with the given ID that runs task t with
+// profile and client. State changes are logged by default; use OnEnter
+// and OnExit to attach more hooks.
+func NewWorker(id int, t models.Task, profile models.Profile, client CheckoutClient) *Worker {
+	w := &Worker{
 		ID:      id,
+		Task:    t,
 		Profile: profile,
 		Client:  client,
-		State:   StateIdle,
+		machine: NewMachine(),
+
+		StageTimeouts: DefaultStageTimeouts(),
+		MaxEventAge:   DefaultMaxEventAge,
+		Retry:         DefaultRetryPolicies(),
 	}
+	w.OnEnter(w.logTransition)
+	return w
 }
 
-// Run processes a single stock event through the checkout state machine.
-// It transitions through states sequentially: ATC -> Payment -> Success/Failed.
-func (w *Worker) Run(event models.StockEvent) error {
-	log.Printf("[worker %d] received stock event for DPCI %s", w.ID, event.Product.DPCI)
+// State returns the worker's current state. It is safe to call from any
+// goroutine.
+func (w *Worker) State() State {
+	return w.machine.State()
+}
 
-	// ATC
-	w.State = StateAddingToCart
-	log.Printf("[worker %d] state -> %s", w.ID, w.State)
+// PublishTo publishes every state change of the worker on bus.
+func (w *Worker) PublishTo(bus *Bus) {
+	w.OnEnter(func(t Transition) {
+		bus.Publish(StateChange{
+			WorkerID: w.ID,
+			TaskID:   w.Task.ID,
+			From:     t.From,
+			To:       t.To,
+			At:       t.At,
+			Elapsed:  t.Elapsed,
+			Err:      t.Err,
+		})
+	})
+}
 
-	cartID, err := w.Client.AddToCart(event)
-	if err != nil {
-		w.State = StateFailed
-		return fmt.Errorf("worker %d: add to cart failed: %w", w.ID, err)
+// OnEnter registers fn to run after the worker enters a state.
+func (w *Worker) OnEnter(fn Hook) {
+	w.machine.OnEnter(fn)
+}
+
+// OnExit registers fn to run before the worker leaves a state.
+func (w *Worker) OnExit(fn Hook) {
+	w.machine.OnExit(fn)
+}
+
+func (w *Worker) logTransition(t Transition) {
+	switch {
+	case t.To == StateIdle:
+		return
+	case t.From == StateIdle:
+		log.Printf("[%s worker %d] state -> %s", w.Task.ID, w.ID, t.To)
+		return
 	}
+	log.Printf("[%s worker %d] state -> %s (%s took %s)", w.Task.ID, w.ID, t.To, t.From, t.Elapsed.Round(time.Millisecond))
+}
+
+// attempt carries the values one checkout produces for later stages.
+type attempt struct {
+	event   models.StockEvent
+	result  *Result
+	started time.Time
+	// relogged is set once the attempt has logged in again after a
+	// session expired, so it only happens once.
+	relogged bool
+	// reservation holds the order total against Worker.Budget until
+	// the outcome is known.
+	reservation *budget.Reservation
+}
+
+// step is the work done in one state of the checkout.
+type step struct {
+	state State
+	run   func(w *Worker, ctx context.Context, a *attempt) error
+}
 
-	// Payment
-	w.State = StateSubmittingPayment
-	log.Printf("[worker %d] state -> %s", w.ID, w.State)
+// checkoutSteps are the working states in order. The transition table in
+// machine.go must allow each to follow the previous one.
+var checkoutSteps = []step{
+	{StateLoggingIn, func(w *Worker, ctx context.Context, a *attempt) error {
+		return w.Client.Login(ctx)
+	}},
+	{StateAddingToCart, func(w *Worker, ctx context.Context, a *attempt) error {
+		quantity := w.quantity(a.event)
+		cartID, err := w.Client.AddToCart(ctx, a.event, quantity, w.Task.Fulfillment)
+		if errors.Is(err, ErrPurchaseLimit) && quantity > 1 {
+			// The limit was not known in advance; one unit is better
+			// than none.
+			log.Printf("[%s worker %d] %d units exceed the purchase limit, adding 1", w.Task.ID, w.ID, quantity)
+			cartID, err = w.Client.AddToCart(ctx, a.event, 1, w.Task.Fulfillment)
+		}
+		a.result.CartID = cartID
+		return err
+	}},
+	{StateVerifyingCart, func(w *Worker, ctx context.Context, a *attempt) error {
+		cart, err := w.Client.GetCart(ctx)
+		if err != nil {
+			return err
+		}
+		if cart.CartID != "" && cart.CartID != a.result.CartID {
+			return fmt.Errorf("cart view returned cart %s, expected %s", cart.CartID, a.result.CartID)
+		}
+		tcin := a.event.Product.TCIN
+		item, ok := cart.Item(tcin)
+		if !ok || item.Quantity == 0 {
+			return fmt.Errorf("TCIN %s not found in cart %s: %w", tcin, cart.CartID, ErrOutOfStock)
+		}
+		// Units left over from an earlier run add to what was just
+		// added; only buy what the task asked for.
+		if item.Quantity > a.result.Requested {
+			log.Printf("[%s worker %d] cart holds %d of TCIN %s, reducing to %d",
+				w.Task.ID, w.ID, item.Quantity, tcin, a.result.Requested)
+			if cart, err = w.Client.UpdateQuantity(ctx, item.CartItemID, a.result.Requested); err != nil {
+				return err
+			}
+			item.Quantity = a.result.Requested
+		}
+		a.result.Quantity, a.result.UnitPrice = item.Quantity, item.UnitPrice
+		if a.result.Partial() {
+			log.Printf("[%s worker %d] cart holds %d of %d requested", w.Task.ID, w.ID, item.Quantity, a.result.Requested)
+		}
+		// Catch a repriced or third-party listing before any payment
+		// details are sent.
+		if limit := w.Task.MaxPrice; limit > 0 && item.UnitPrice > limit {
+			return fmt.Errorf("%w: unit price %s exceeds max_price %s", ErrPriceLimit, item.UnitPrice, limit)
+		}
+		return w.tidyCart(ctx, cart, tcin)
+	}},
+	{StateSelectingFulfillment, func(w *Worker, ctx context.Context, a *attempt) error {
+		f, err := w.Client.SelectFulfillment(ctx, a.result.CartID, w.Task, w.Profile)
+		if err != nil {
+			return err
+		}
+		if w.Task.Fulfillment.IsPickup() {
+			a.result.PickupStoreID = f.LocationID
+			a.result.PickupStoreName = f.LocationName
+			if a.result.PickupStoreName == "" && a.event.LocationID == f.LocationID {
+				a.result.PickupStoreName = a.event.LocationName
+			}
+			log.Printf("[%s worker %d] %s at store %s %s", w.Task.ID, w.ID, w.Task.Fulfillment, f.LocationID, a.result.PickupStoreName)
+		}
+		return nil
+	}},
+	{StateApplyingPayment, func(w *Worker, ctx context.Context, a *attempt) error {
+		tenders, err := w.Client.ApplyPayment(ctx, a.result.CartID, w.Profile)
+		a.result.Tenders = tenders
+		return err
+	}},
+	{StateReviewingTotals, func(w *Worker, ctx context.Context, a *attempt) error {
+		totals, err := w.Client.ReviewTotals(ctx, a.result.CartID)
+		if err != nil {
+			return err
+		}
+		a.result.Totals = totals
+		splitTotal(a.result.Tenders, totals.GrandTotal)
+		if err := w.checkTotals(totals, a.result.Quantity); err != nil {
+			return err
+		}
+		return w.reserve(a, totals.GrandTotal, cardShare(a.result.Tenders, totals.GrandTotal))
+	}},
+	{StatePlacingOrder, func(w *Worker, ctx context.Context, a *attempt) error {
+		orderID, err := w.Client.PlaceOrder(ctx, a.result.CartID)
+		a.result.OrderID = orderID
+		w.Claims.Claim(orderID)
+		return err
+	}},
+	{StateConfirming, func(w *Worker, ctx context.Context, a *attempt) error {
+		// The order exists once PlaceOrder returned an ID; failing to
+		// confirm it must not report the attempt as failed.
+		if err := w.Client.ConfirmOrder(ctx, a.result.OrderID); err != nil {
+			log.Printf("[%s worker %d] could not confirm order %s: %v", w.Task.ID, w.ID, a.result.OrderID, err)
+		}
+		return nil
+	}},
+}
+
+// Run processes a single stock event through the checkout state machine,
+// entering each state in checkoutSteps in turn and skipping login when
+// the client is already authenticated. Failed stages are retried as
+// their RetryPolicy allows. Cancelling ctx aborts the current
+// stage; each stage also gets its own deadline from StageTimeouts.
+func (w *Worker) Run(ctx context.Context, event models.StockEvent) (Result, error) {
+	result := Result{
+		TaskID:    w.Task.ID,
+		WorkerID:  w.ID,
+		Profile:   w.Profile.Name,
+		Product:   event.Product,
+		Stage:     StateIdle,
+		Requested: max(w.Task.Quantity, 1),
+
+		Fulfillment: w.Task.Fulfillment,
+	}
+
+	if age := time.Since(event.DetectedAt); w.MaxEventAge > 0 && !event.DetectedAt.IsZero() && age > w.MaxEventAge {
+		result.State = w.State()
+		return result, fmt.Errorf("%s worker %d: %w: TCIN %s detected %s ago (was %s)",
+			w.Task.ID, w.ID, ErrStaleEvent, event.Product.TCIN, age.Round(time.Millisecond), event.PreviousState)
+	}
+	if !event.AvailableFor(w.Task.Fulfillment) {
+		result.State = w.State()
+		return result, fmt.Errorf("%s worker %d: %w: TCIN %s for %s",
+			w.Task.ID, w.ID, ErrUnavailable, event.Product.TCIN, w.Task.Fulfillment)
+	}
+	log.Printf("[%s worker %d] received stock event for TCIN %s", w.Task.ID, w.ID, event.Product.TCIN)
+
+	if w.machine.State().Terminal() {
+		if err := w.transition(StateIdle); err != nil {
+			return result, err
+		}
+	}
+
+	a := &attempt{event: event, result: &result, started: time.Now()}
+	err := w.checkout(ctx, a)
+	w.settle(a, err)
+	return result, err
+}
 
-	orderID, err := w.Client.SubmitPayment(cartID, w.Profile)
+// checkout runs every step of checkoutSteps for a.
+func (w *Worker) checkout(ctx context.Context, a *attempt) error {
+	for _, s := range checkoutSteps {
+		if s.state == StateLoggingIn && w.Client.LoggedIn() {
+			continue
+		}
+		if err := w.transition(s.state); err != nil {
+			return err
+		}
+		a.result.Stage = s.state
+
+		if err := w.runStep(ctx, s, a); err != nil {
+			err = fmt.Errorf("%s worker %d: %s: %w", w.Task.ID, w.ID, s.state, err)
+			if terr := w.machine.Fail(err); terr != nil {
+				return fmt.Errorf("%s worker %d: %w", w.Task.ID, w.ID, terr)
+			}
+			a.result.State = StateFailed
+			return err
+		}
+	}
+
+	if err := w.transition(StateSuccess); err != nil {
+		return err
+	}
+	a.result.State = StateSuccess
+	log.Printf("[%s worker %d] order: %s", w.Task.ID, w.ID, a.result.OrderID)
+	if len(a.result.Tenders) > 1 {
+		log.Printf("[%s worker %d] paid with %s", w.Task.ID, w.ID, models.FormatTenders(a.result.Tenders))
+	}
+	return nil
+}
+
+// settle commits the attempt's budget reservation if an order was, or
+// may have been, placed and releases it otherwise.
+func (w *Worker) settle(a *attempt, err error) {
+	if a.reservation == nil {
+		return
+	}
+	if a.result.OrderMayExist(err) {
+		w.Budget.Commit(a.reservation)
+		return
+	}
+	w.Budget.Release(a.reservation)
+}
+
+// tidyCart applies the task's UnrelatedItems policy to every line in cart
+// other than tcin and the TCINs of tasks sharing the account.
+func (w *Worker) tidyCart(ctx context.Context, cart models.Cart, tcin string) error {
+	var others []models.CartItem
+	for _, item := range cart.CartItems {
+		switch {
+		case item.TCIN == tcin:
+		case w.SharedTCINs[item.TCIN]:
+			log.Printf("[%s worker %d] leaving %d x %s in the cart for another task on this account",
+				w.Task.ID, w.ID, item.Quantity, item.Title())
+		default:
+			others = append(others, item)
+		}
+	}
+	if len(others) == 0 {
+		return nil
+	}
+
+	titles := make([]string, len(others))
+	for i, item := range others {
+		titles[i] = fmt.Sprintf("%d x %s", item.Quantity, item.Title())
+	}
+	switch w.Task.UnrelatedItems {
+	case models.CartKeep:
+		log.Printf("[%s worker %d] checking out unrelated cart items too: %s",
+			w.Task.ID, w.ID, strings.Join(titles, ", "))
+		return nil
+	case models.CartAbort:
+		return fmt.Errorf("%w: %s", ErrUnrelatedItems, strings.Join(titles, ", "))
+	}
+	for i, item := range others {
+		log.Printf("[%s worker %d] removing unrelated cart item %s", w.Task.ID, w.ID, titles[i])
+		if _, err := w.Client.RemoveItem(ctx, item.CartItemID); err != nil {
+			return fmt.Errorf("failed to remove %s from cart: %w", item.Title(), err)
+		}
+	}
+	return nil
+}
+
+// reserve holds amount against the worker's budget for the attempt, with
+// cardAmount of it against the card, replacing any earlier reservation
+// from a retried stage.
+func (w *Worker) reserve(a *attempt, amount, cardAmount models.Money) error {
+	if w.Budget == nil {
+		return nil
+	}
+	if a.reservation != nil {
+		w.Budget.Release(a.reservation)
+		a.reservation = nil
+	}
+	r, err := w.Budget.Reserve(w.Profile.Name, budget.CardKey(w.Profile.Payment), amount, cardAmount)
 	if err != nil {
-		w.State = StateFailed
-		return fmt.Errorf("worker %d: payment failed: %w", w.ID, err)
+		return err
 	}
+	a.reservation = r
+	return nil
+}
+
+// checkTotals refuses a cart whose final totals break the task's price
+// limits. The per-unit check is repeated against the summary because the
+// price may change after VerifyCart.
+func (w *Worker) checkTotals(totals models.CartSummary, quantity int) error {
+	if limit := w.Task.MaxPrice; limit > 0 && quantity > 0 && totals.ProductTotal > limit*models.Money(quantity) {
+		return fmt.Errorf("%w: items total %s for %d units exceeds max_price %s each",
+			ErrPriceLimit, totals.ProductTotal, quantity, limit)
+	}
+	if limit := w.Task.MaxTotal; limit > 0 && totals.GrandTotal > limit {
+		return fmt.Errorf("%w: total %s (items %s, shipping %s, tax %s) exceeds max_total %s",
+			ErrPriceLimit, totals.GrandTotal, totals.ProductTotal, totals.Shipping, totals.Tax, limit)
+	}
+	return nil
+}
+
+// splitTotal sets the card's share of a split payment to what the gift
+// cards leave of total, since tax and shipping can change after the
+// tenders were applied.
+func splitTotal(tenders []models.Tender, total models.Money) {
+	if len(tenders) < 2 || tenders[len(tenders)-1].Type != models.TenderCard {
+		return
+	}
+	rest := total
+	for _, t := range tenders[:len(tenders)-1] {
+		rest -= t.Amount
+	}
+	tenders[len(tenders)-1].Amount = max(rest, 0)
+}
 
-	w.State = StateSuccess
-	log.Printf("[worker %d] state -> %s | order: %s", w.ID, w.State, orderID)
+// cardShare returns how much of total the card pays: its tender's amount
+// once splitTotal has run, nothing if gift cards alone paid, or all of
+// total if the tenders are unknown.
+func cardShare(tenders []models.Tender, total models.Money) models.Money {
+	if len(tenders) == 0 {
+		return total
+	}
+	if last := tenders[len(tenders)-1]; last.Type == models.TenderCard {
+		if len(tenders) == 1 {
+			return total
+		}
+		return last.Amount
+	}
+	return 0
+}
+
+// quantity returns how many units to add for event: the task's quantity,
+// capped by the purchase limit when the event carries one.
+func (w *Worker) quantity(event models.StockEvent) int {
+	q := max(w.Task.Quantity, 1)
+	if event.PurchaseLimit > 0 && q > event.PurchaseLimit {
+		log.Printf("[%s worker %d] purchase limit is %d, requesting %d of %d",
+			w.Task.ID, w.ID, event.PurchaseLimit, event.PurchaseLimit, q)
+		q = event.PurchaseLimit
+	}
+	return q
+}
+
+// transition moves the state machine. Illegal transitions are a
+// programming error in checkoutSteps and are returned with the worker's
+// identity.
+func (w *Worker) transition(to State) error {
+	if err := w.machine.Transition(to); err != nil {
+		return fmt.Errorf("%s worker %d: %w", w.Task.ID, w.ID, err)
+	}
 	return nil
 }
+
+// stageContext derives a context bounded by the stage's timeout, if any.
+func (w *Worker) stageContext(ctx context.Context, state State) (context.Context, context.CancelFunc) {
+	if d := w.StageTimeouts[state]; d > 0 {
+		return context.WithTimeout(ctx, d)
+	}
+	return context.WithCancel(ctx)
+}
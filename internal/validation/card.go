@@ -0,0 +1,142 @@
+// Package validation checks and normalizes checkout profiles: card number
+// Luhn and brand checks, expiry, CVV length, and US address formats.
+package validation
+
+import (
+	"strconv"
+	"strings"
+)
+
+// CardBrand is the card network detected from a card number's BIN.
+type CardBrand int
+
+const (
+	// BrandUnknown means the BIN did not match any supported network.
+	BrandUnknown CardBrand = iota
+	// BrandVisa is a Visa card (BIN 4).
+	BrandVisa
+	// BrandMastercard is a Mastercard (BIN 51-55 or 2221-2720).
+	BrandMastercard
+	// BrandAmex is an American Express card (BIN 34 or 37).
+	BrandAmex
+	// BrandDiscover is a Discover card (BIN 6011, 622126-622925, 644-649 or 65).
+	BrandDiscover
+)
+
+// String returns a human-readable label for the brand.
+func (b CardBrand) String() string {
+	switch b {
+	case BrandVisa:
+		return "Visa"
+	case BrandMastercard:
+		return "Mastercard"
+	case BrandAmex:
+		return "American Express"
+	case BrandDiscover:
+		return "Discover"
+	default:
+		return "Unknown"
+	}
+}
+
+// TargetCardType returns the card_type value Target's checkout API
+// expects for the brand, or an empty string for BrandUnknown.
+func (b CardBrand) TargetCardType() string {
+	switch b {
+	case BrandVisa:
+		return "VISA"
+	case BrandMastercard:
+		return "MASTERCARD"
+	case BrandAmex:
+		return "AMEX"
+	case BrandDiscover:
+		return "DISCOVER"
+	default:
+		return ""
+	}
+}
+
+// CVVLength returns the number of CVV digits printed on cards of this
+// brand: four for Amex, three for everyone else.
+func (b CardBrand) CVVLength() int {
+	if b == BrandAmex {
+		return 4
+	}
+	return 3
+}
+
+// validLength reports whether n is a valid PAN length for the brand.
+func (b CardBrand) validLength(n int) bool {
+	switch b {
+	case BrandVisa:
+		return n == 13 || n == 16 || n == 19
+	case BrandMastercard:
+		return n == 16
+	case BrandAmex:
+		return n == 15
+	case BrandDiscover:
+		return n >= 16 && n <= 19
+	default:
+		return false
+	}
+}
+
+// DetectBrand returns the card network for number based on its leading
+// digits. Spaces and dashes are ignored.
+func DetectBrand(number string) CardBrand {
+	digits := CardDigits(number)
+	prefix := func(n int) int {
+		if len(digits) < n {
+			return -1
+		}
+		v, _ := strconv.Atoi(digits[:n])
+		return v
+	}
+
+	switch {
+	case prefix(1) == 4:
+		return BrandVisa
+	case prefix(2) >= 51 && prefix(2) <= 55, prefix(4) >= 2221 && prefix(4) <= 2720:
+		return BrandMastercard
+	case prefix(2) == 34, prefix(2) == 37:
+		return BrandAmex
+	case prefix(4) == 6011, prefix(2) == 65,
+		prefix(3) >= 644 && prefix(3) <= 649,
+		prefix(6) >= 622126 && prefix(6) <= 622925:
+		return BrandDiscover
+	default:
+		return BrandUnknown
+	}
+}
+
+// CardDigits strips the spaces and dashes people commonly type into card
+// numbers.
+func CardDigits(number string) string {
+	return strings.NewReplacer(" ", "", "-", "").Replace(number)
+}
+
+// Luhn reports whether number passes the Luhn checksum. It returns false
+// for anything that is not all digits.
+func Luhn(number string) bool {
+	if number == "" {
+		return false
+	}
+	sum := 0
+	double := false
+	for i := len(number) - 1; i >= 0; i-- {
+		c := number[i]
+		if c < '0' || c > '9' {
+			return false
+		}
+		d := int(c - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
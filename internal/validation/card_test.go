@@ -0,0 +1,196 @@
+package validation
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"zeng_bot/internal/models"
+)
+
+var now = time.Date(2026, time.March, 15, 12, 0, 0, 0, time.UTC)
+
+// fieldErrors returns the messages reported for field.
+func fieldErrors(errs []FieldError, field string) []string {
+	var msgs []string
+	for _, e := range errs {
+		if e.Field == field {
+			msgs = append(msgs, e.Message)
+		}
+	}
+	return msgs
+}
+
+func TestLuhn(t *testing.T) {
+	tests := []struct {
+		number string
+		want   bool
+	}{
+		{"4111111111111111", true},
+		{"4111111111111112", false},
+		{"378282246310005", true},
+		{"0", true},
+		{"18", true},
+		{"", false},
+		{"4111 1111 1111 1111", false},
+		{"41111111111111a1", false},
+	}
+	for _, tt := range tests {
+		if got := Luhn(tt.number); got != tt.want {
+			t.Errorf("Luhn(%q) = %t, want %t", tt.number, got, tt.want)
+		}
+	}
+}
+
+func TestDetectBrand(t *testing.T) {
+	tests := []struct {
+		number string
+		want   CardBrand
+	}{
+		{"4111111111111111", BrandVisa},
+		{"4111 1111 1111 1111", BrandVisa},
+		{"4111-1111-1111-1111", BrandVisa},
+		{"5100000000000000", BrandMastercard},
+		{"5555555555554444", BrandMastercard},
+		{"5600000000000000", BrandUnknown},
+		{"2220999999999999", BrandUnknown},
+		{"2221000000000009", BrandMastercard},
+		{"2720999999999996", BrandMastercard},
+		{"2721000000000000", BrandUnknown},
+		{"340000000000009", BrandAmex},
+		{"378282246310005", BrandAmex},
+		{"360000000000000", BrandUnknown},
+		{"6011111111111117", BrandDiscover},
+		{"6221250000000000", BrandUnknown},
+		{"6221260000000000", BrandDiscover},
+		{"6229250000000000", BrandDiscover},
+		{"6229260000000000", BrandUnknown},
+		{"6430000000000000", BrandUnknown},
+		{"6440000000000000", BrandDiscover},
+		{"6490000000000000", BrandDiscover},
+		{"6500000000000002", BrandDiscover},
+		{"", BrandUnknown},
+		{"1234567890123456", BrandUnknown},
+	}
+	for _, tt := range tests {
+		if got := DetectBrand(tt.number); got != tt.want {
+			t.Errorf("DetectBrand(%q) = %s, want %s", tt.number, got, tt.want)
+		}
+	}
+}
+
+func TestPaymentCardNumber(t *testing.T) {
+	tests := []struct {
+		name   string
+		number string
+		cvv    string
+		want   string // substring of the card_number error, or "" for none
+	}{
+		{"Visa 16", "4111111111111111", "123", ""},
+		{"Visa 13", "4222222222222", "123", ""},
+		{"Visa 19", "4111111111111111110", "123", ""},
+		{"Visa with spaces", "4111 1111 1111 1111", "123", ""},
+		{"Visa 14 digits", "42222222222226", "123", "14 digits is not a valid Visa card number"},
+		{"Visa bad checksum", "4111111111111112", "123", "Luhn"},
+		{"Mastercard 5x", "5555555555554444", "123", ""},
+		{"Mastercard 2x", "2223003122003222", "123", ""},
+		{"Mastercard 15 digits", "555555555555444", "123", "not a valid Mastercard"},
+		{"Mastercard bad checksum", "5555555555554445", "123", "Luhn"},
+		{"Amex 34", "340000000000009", "1234", ""},
+		{"Amex 37", "378282246310005", "1234", ""},
+		{"Amex 16 digits", "3782822463100050", "1234", "not a valid American Express"},
+		{"Amex bad checksum", "378282246310006", "1234", "Luhn"},
+		{"Discover 6011", "6011111111111117", "123", ""},
+		{"Discover 644", "6445644564456445", "123", ""},
+		{"Discover 65", "6500000000000002", "123", ""},
+		{"Discover 19", "6011000000000000001", "123", ""},
+		{"Discover 15 digits", "601111111111111", "123", "not a valid Discover"},
+		{"Discover bad checksum", "6011111111111118", "123", "Luhn"},
+		{"unsupported brand", "3530111333300000", "123", "unsupported card brand"},
+		{"letters", "4111abcd11111111", "123", "only digits"},
+		{"missing", "", "123", "required"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := models.Payment{CardNumber: tt.number, CVV: tt.cvv, ExpMonth: "12", ExpYear: "2030"}
+			msgs := fieldErrors(Payment("payment", p, now), "payment.card_number")
+			switch {
+			case tt.want == "" && len(msgs) > 0:
+				t.Errorf("card_number errors %q, want none", msgs)
+			case tt.want != "" && (len(msgs) != 1 || !strings.Contains(msgs[0], tt.want)):
+				t.Errorf("card_number errors %q, want one containing %q", msgs, tt.want)
+			}
+		})
+	}
+}
+
+func TestPaymentCVV(t *testing.T) {
+	const (
+		visa = "4111111111111111"
+		amex = "378282246310005"
+	)
+	tests := []struct {
+		number string
+		cvv    string
+		want   string // substring of the cvv error, or "" for none
+	}{
+		{visa, "123", ""},
+		{visa, "1234", "Visa cards use a 3-digit CVV"},
+		{visa, "12", "Visa cards use a 3-digit CVV"},
+		{amex, "1234", ""},
+		{amex, "123", "American Express cards use a 4-digit CVV"},
+		{visa, "12a", "only digits"},
+		{visa, "", "required"},
+		// With no known brand only the length range is checked.
+		{"1234", "1234", ""},
+		{"1234", "12345", "must be 3 or 4 digits"},
+	}
+	for _, tt := range tests {
+		p := models.Payment{CardNumber: tt.number, CVV: tt.cvv, ExpMonth: "12", ExpYear: "2030"}
+		msgs := fieldErrors(Payment("payment", p, now), "payment.cvv")
+		switch {
+		case tt.want == "" && len(msgs) > 0:
+			t.Errorf("card %s, CVV %q: errors %q, want none", tt.number, tt.cvv, msgs)
+		case tt.want != "" && (len(msgs) != 1 || !strings.Contains(msgs[0], tt.want)):
+			t.Errorf("card %s, CVV %q: errors %q, want one containing %q", tt.number, tt.cvv, msgs, tt.want)
+		}
+	}
+}
+
+func TestPaymentSavedCardCVV(t *testing.T) {
+	for cvv, wantErr := range map[string]bool{"": false, "123": false, "1234": false, "12": true, "12345": true, "abc": true} {
+		p := models.Payment{SavedCard: "1111", CVV: cvv}
+		if msgs := fieldErrors(Payment("payment", p, now), "payment.cvv"); (len(msgs) > 0) != wantErr {
+			t.Errorf("saved card CVV %q: errors %q, want error %t", cvv, msgs, wantErr)
+		}
+	}
+}
+
+func TestPaymentExpiry(t *testing.T) {
+	tests := []struct {
+		month, year string
+		wantErr     bool
+	}{
+		{"03", "2026", false}, // valid through the end of the month
+		{"3", "26", false},
+		{"02", "2026", true},
+		{"12", "2025", true},
+		{"13", "2030", true},
+		{"0", "2030", true},
+		{"12", "soon", true},
+	}
+	for _, tt := range tests {
+		p := models.Payment{CardNumber: "4111111111111111", CVV: "123", ExpMonth: tt.month, ExpYear: tt.year}
+		if errs := Payment("payment", p, now); (len(errs) > 0) != tt.wantErr {
+			t.Errorf("expiry %s/%s: errors %v, want error %t", tt.month, tt.year, errs, tt.wantErr)
+		}
+	}
+}
+
+func TestAllDigits(t *testing.T) {
+	for s, want := range map[string]bool{"0": true, "12345678": true, "": false, "12a": false, " 12": false, "-1": false, "١٢": false} {
+		if got := AllDigits(s); got != want {
+			t.Errorf("AllDigits(%q) = %t, want %t", s, got, want)
+		}
+	}
+}
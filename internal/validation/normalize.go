@@ -0,0 +1,104 @@
+package validation
+
+import (
+	"strings"
+
+	"zeng_bot/internal/models"
+)
+
+// countryCodes maps common spellings of the United States to "US".
+var countryCodes = map[string]string{
+	"":                         "US",
+	"us":                       "US",
+	"usa":                      "US",
+	"u.s.":                     "US",
+	"u.s.a.":                   "US",
+	"united states":            "US",
+	"united states of america": "US",
+}
+
+// NormalizeProfile returns p with whitespace trimmed, the email
+// lower-cased, the phone reduced to ten digits, card numbers reduced to
+// digits, empty gift cards dropped and both addresses normalized. It does
+// not validate; run Profile afterwards.
+func NormalizeProfile(p models.Profile) models.Profile {
+	p.Name = collapseSpaces(p.Name)
+	p.Email = strings.ToLower(strings.TrimSpace(p.Email))
+	if digits := phoneDigits(p.Phone); len(digits) == 10 {
+		p.Phone = digits
+	}
+	p.Billing = NormalizeAddress(p.Billing)
+	p.Shipping = NormalizeAddress(p.Shipping)
+	var giftCards []models.GiftCard
+	for _, gc := range p.GiftCards {
+		gc.Number = CardDigits(strings.TrimSpace(gc.Number))
+		gc.PIN = strings.TrimSpace(gc.PIN)
+		// Blank CSV columns leave empty cards behind.
+		if gc != (models.GiftCard{}) {
+			giftCards = append(giftCards, gc)
+		}
+	}
+	p.GiftCards = giftCards
+	p.Payment.SavedCard = strings.TrimSpace(p.Payment.SavedCard)
+	p.Payment.CardNumber = CardDigits(strings.TrimSpace(p.Payment.CardNumber))
+	p.Payment.CVV = strings.TrimSpace(p.Payment.CVV)
+	p.Payment.ExpMonth = normalizeMonth(p.Payment.ExpMonth)
+	p.Payment.ExpYear = strings.TrimSpace(p.Payment.ExpYear)
+	return p
+}
+
+// NormalizeAddress collapses whitespace, converts full state names to
+// their USPS code, formats nine-digit ZIPs as ZIP+4 and defaults the
+// country to "US".
+func NormalizeAddress(a models.Address) models.Address {
+	a.Line1 = collapseSpaces(a.Line1)
+	a.Line2 = collapseSpaces(a.Line2)
+	a.City = collapseSpaces(a.City)
+
+	state := collapseSpaces(a.State)
+	if code, ok := stateCodes[strings.ToLower(state)]; ok {
+		state = code
+	}
+	a.State = strings.ToUpper(state)
+
+	zip := strings.ReplaceAll(strings.TrimSpace(a.ZipCode), " ", "")
+	if len(zip) == 9 && digitsPattern.MatchString(zip) {
+		zip = zip[:5] + "-" + zip[5:]
+	}
+	a.ZipCode = zip
+
+	country := collapseSpaces(a.Country)
+	if code, ok := countryCodes[strings.ToLower(country)]; ok {
+		country = code
+	}
+	a.Country = strings.ToUpper(country)
+	return a
+}
+
+func collapseSpaces(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// phoneDigits strips punctuation and a leading US country code.
+func phoneDigits(phone string) string {
+	var b strings.Builder
+	for _, r := range phone {
+		if r >= '0' && r <= '9' {
+			b.WriteRune(r)
+		}
+	}
+	digits := b.String()
+	if len(digits) == 11 && digits[0] == '1' {
+		digits = digits[1:]
+	}
+	return digits
+}
+
+// normalizeMonth zero-pads single-digit months so "3" becomes "03".
+func normalizeMonth(month string) string {
+	month = strings.TrimSpace(month)
+	if len(month) == 1 && month[0] >= '1' && month[0] <= '9' {
+		return "0" + month
+	}
+	return month
+}
@@ -0,0 +1,236 @@
+package validation
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"zeng_bot/internal/models"
+)
+
+var (
+	zipPattern    = regexp.MustCompile(`^\d{5}(-\d{4})?$`)
+	digitsPattern = regexp.MustCompile(`^\d+$`)
+)
+
+// usStates lists the USPS codes Target ships to: the 50 states, DC,
+// territories and military mail.
+var usStates = map[string]string{
+	"AL": "Alabama", "AK": "Alaska", "AZ": "Arizona", "AR": "Arkansas", "CA": "California",
+	"CO": "Colorado", "CT": "Connecticut", "DE": "Delaware", "FL": "Florida", "GA": "Georgia",
+	"HI": "Hawaii", "ID": "Idaho", "IL": "Illinois", "IN": "Indiana", "IA": "Iowa",
+	"KS": "Kansas", "KY": "Kentucky", "LA": "Louisiana", "ME": "Maine", "MD": "Maryland",
+	"MA": "Massachusetts", "MI": "Michigan", "MN": "Minnesota", "MS": "Mississippi", "MO": "Missouri",
+	"MT": "Montana", "NE": "Nebraska", "NV": "Nevada", "NH": "New Hampshire", "NJ": "New Jersey",
+	"NM": "New Mexico", "NY": "New York", "NC": "North Carolina", "ND": "North Dakota", "OH": "Ohio",
+	"OK": "Oklahoma", "OR": "Oregon", "PA": "Pennsylvania", "RI": "Rhode Island", "SC": "South Carolina",
+	"SD": "South Dakota", "TN": "Tennessee", "TX": "Texas", "UT": "Utah", "VT": "Vermont",
+	"VA": "Virginia", "WA": "Washington", "WV": "West Virginia", "WI": "Wisconsin", "WY": "Wyoming",
+	"DC": "District of Columbia", "PR": "Puerto Rico", "GU": "Guam", "VI": "Virgin Islands",
+	"AS": "American Samoa", "MP": "Northern Mariana Islands",
+	"AA": "Armed Forces Americas", "AE": "Armed Forces Europe", "AP": "Armed Forces Pacific",
+}
+
+// stateCodes maps lower-cased full state names back to their codes.
+var stateCodes = func() map[string]string {
+	m := make(map[string]string, len(usStates))
+	for code, name := range usStates {
+		m[strings.ToLower(name)] = code
+	}
+	return m
+}()
+
+// ValidState reports whether code is a USPS state code Target ships to.
+func ValidState(code string) bool {
+	return usStates[code] != ""
+}
+
+// ValidZip reports whether zip is a five-digit or ZIP+4 code.
+func ValidZip(zip string) bool {
+	return zipPattern.MatchString(zip)
+}
+
+// AllDigits reports whether s is one or more ASCII digits.
+func AllDigits(s string) bool {
+	return digitsPattern.MatchString(s)
+}
+
+// FieldError describes a single invalid field. Field is the JSON path of
+// the value, e.g. "profile.payment.cvv".
+type FieldError struct {
+	Field   string
+	Message string
+}
+
+func (e FieldError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Field, e.Message)
+}
+
+// checker accumulates field errors while walking a profile.
+type checker struct {
+	now    time.Time
+	errors []FieldError
+}
+
+func (c *checker) add(field, format string, args ...interface{}) {
+	c.errors = append(c.errors, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// Profile checks every field of p and returns the problems found, with
+// field paths prefixed by path. Expiry is checked against now.
+func Profile(path string, p models.Profile, now time.Time) []FieldError {
+	c := &checker{now: now}
+	c.profile(path, p)
+	return c.errors
+}
+
+// Address checks a single US address.
+func Address(path string, a models.Address) []FieldError {
+	c := &checker{}
+	c.address(path, a)
+	return c.errors
+}
+
+// Payment checks a single card: Luhn, supported brand, length and CVV
+// per brand, and expiry against now.
+func Payment(path string, p models.Payment, now time.Time) []FieldError {
+	c := &checker{now: now}
+	c.payment(path, p)
+	return c.errors
+}
+
+func (c *checker) profile(path string, p models.Profile) {
+	if p.Name == "" {
+		c.add(path+".name", "required")
+	}
+	if p.Email == "" {
+		c.add(path+".email", "required")
+	} else if !strings.Contains(p.Email, "@") {
+		c.add(path+".email", "%q is not a valid email address", p.Email)
+	}
+	if p.Password == "" {
+		c.add(path+".password", "required (Target does not allow guest checkout)")
+	}
+	if p.Phone != "" && len(phoneDigits(p.Phone)) != 10 {
+		c.add(path+".phone", "must be a 10-digit US phone number")
+	}
+	c.address(path+".billing", p.Billing)
+	c.address(path+".shipping", p.Shipping)
+	seen := make(map[string]bool, len(p.GiftCards))
+	for i, gc := range p.GiftCards {
+		field := fmt.Sprintf("%s.gift_cards[%d]", path, i)
+		c.giftCard(field, gc)
+		if seen[gc.Number] {
+			c.add(field+".number", "duplicate gift card")
+		}
+		seen[gc.Number] = true
+	}
+	// Gift cards alone may pay; the card then only has to be valid if
+	// one is given.
+	if len(p.GiftCards) == 0 || p.Payment != (models.Payment{}) {
+		c.payment(path+".payment", p.Payment)
+	}
+}
+
+func (c *checker) giftCard(path string, g models.GiftCard) {
+	switch {
+	case g.Number == "":
+		c.add(path+".number", "required")
+	case !digitsPattern.MatchString(g.Number):
+		c.add(path+".number", "must contain only digits")
+	case len(g.Number) != 15 && len(g.Number) != 16:
+		c.add(path+".number", "Target gift cards have 15 or 16 digits, got %d", len(g.Number))
+	}
+	switch {
+	case g.PIN == "":
+		c.add(path+".pin", "required")
+	case !digitsPattern.MatchString(g.PIN) || (len(g.PIN) != 4 && len(g.PIN) != 8):
+		c.add(path+".pin", "must be 4 or 8 digits")
+	}
+}
+
+func (c *checker) address(path string, a models.Address) {
+	if a.Line1 == "" {
+		c.add(path+".line1", "required")
+	}
+	if a.City == "" {
+		c.add(path+".city", "required")
+	}
+	switch {
+	case a.State == "":
+		c.add(path+".state", "required")
+	case usStates[a.State] == "":
+		c.add(path+".state", "%q is not a US state code", a.State)
+	}
+	switch {
+	case a.ZipCode == "":
+		c.add(path+".zip_code", "required")
+	case !zipPattern.MatchString(a.ZipCode):
+		c.add(path+".zip_code", "%q is not a valid ZIP code", a.ZipCode)
+	}
+	if a.Country != "" && a.Country != "US" {
+		c.add(path+".country", "only US addresses are supported, got %q", a.Country)
+	}
+}
+
+func (c *checker) payment(path string, p models.Payment) {
+	// A saved card is checked by Target; only a CVV for its challenge
+	// can be given, and typing the card in is optional.
+	if p.SavedCard != "" && p.CardNumber == "" {
+		if p.CVV != "" && (!digitsPattern.MatchString(p.CVV) || len(p.CVV) < 3 || len(p.CVV) > 4) {
+			c.add(path+".cvv", "must be 3 or 4 digits")
+		}
+		if p.ExpMonth != "" || p.ExpYear != "" {
+			c.add(path, "exp_month and exp_year need a card_number; a saved card's expiry comes from the wallet")
+		}
+		return
+	}
+
+	number := CardDigits(p.CardNumber)
+	brand := DetectBrand(number)
+	switch {
+	case number == "":
+		c.add(path+".card_number", "required")
+	case !digitsPattern.MatchString(number):
+		c.add(path+".card_number", "must contain only digits")
+	case brand == BrandUnknown:
+		c.add(path+".card_number", "unsupported card brand (want Visa, Mastercard, Amex or Discover)")
+	case !brand.validLength(len(number)):
+		c.add(path+".card_number", "%d digits is not a valid %s card number", len(number), brand)
+	case !Luhn(number):
+		c.add(path+".card_number", "fails the Luhn check (typo?)")
+	}
+
+	switch {
+	case p.CVV == "":
+		c.add(path+".cvv", "required")
+	case !digitsPattern.MatchString(p.CVV):
+		c.add(path+".cvv", "must contain only digits")
+	case brand != BrandUnknown && len(p.CVV) != brand.CVVLength():
+		c.add(path+".cvv", "%s cards use a %d-digit CVV", brand, brand.CVVLength())
+	case len(p.CVV) < 3 || len(p.CVV) > 4:
+		c.add(path+".cvv", "must be 3 or 4 digits")
+	}
+
+	month, err := strconv.Atoi(p.ExpMonth)
+	if err != nil || month < 1 || month > 12 {
+		c.add(path+".exp_month", "must be 1-12, got %q", p.ExpMonth)
+		return
+	}
+	year, err := strconv.Atoi(p.ExpYear)
+	if err != nil {
+		c.add(path+".exp_year", "must be a year, got %q", p.ExpYear)
+		return
+	}
+	if year < 100 {
+		year += 2000
+	}
+
+	// Cards are valid through the last day of their expiry month.
+	expires := time.Date(year, time.Month(month)+1, 1, 0, 0, 0, 0, time.UTC)
+	if !c.now.Before(expires) {
+		c.add(path, "card expired %02d/%d", month, year)
+	}
+}
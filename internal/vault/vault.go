@@ -0,0 +1,253 @@
+// Package vault stores profiles, including account passwords and card
+// data, in a passphrase-encrypted file. The key is derived with Argon2id
+// and the profiles are sealed with AES-256-GCM, so credentials are only
+// ever decrypted in memory.
+package vault
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/crypto/argon2"
+
+	"zeng_bot/internal/models"
+)
+
+const (
+	fileVersion = 1
+	kdfArgon2id = "argon2id"
+	keyLen      = 32 // AES-256
+	saltLen     = 16
+	nonceLen    = 12 // the standard GCM nonce
+)
+
+// ErrWrongPassphrase is returned by Open when the vault cannot be
+// decrypted, which almost always means the passphrase is wrong.
+var ErrWrongPassphrase = errors.New("wrong passphrase or corrupted vault")
+
+// ErrCorrupt is returned by Open when the vault file is truncated or its
+// stored parameters are invalid, whatever the passphrase.
+var ErrCorrupt = errors.New("corrupt vault")
+
+// KDFParams are the Argon2id cost parameters stored alongside the salt so
+// they can be raised for new vaults without breaking existing ones.
+type KDFParams struct {
+	Name    string `json:"name"`
+	Salt    []byte `json:"salt"`
+	Time    uint32 `json:"time"`
+	Memory  uint32 `json:"memory_kib"`
+	Threads uint8  `json:"threads"`
+}
+
+// DefaultKDFParams follow the RFC 9106 second recommended option: 3
+// passes over 64 MiB.
+func DefaultKDFParams() KDFParams {
+	return KDFParams{Name: kdfArgon2id, Time: 3, Memory: 64 * 1024, Threads: 4}
+}
+
+// file is the on-disk JSON envelope. Only KDF parameters and the nonce are
+// stored in the clear.
+type file struct {
+	Version    int       `json:"version"`
+	KDF        KDFParams `json:"kdf"`
+	Nonce      []byte    `json:"nonce"`
+	Ciphertext []byte    `json:"ciphertext"`
+}
+
+// payload is the plaintext sealed inside the vault.
+type payload struct {
+	Profiles []models.Profile `json:"profiles"`
+}
+
+// Vault is an opened, decrypted vault. Changes are only persisted by Save.
+type Vault struct {
+	path     string
+	kdf      KDFParams
+	key      []byte
+	profiles []models.Profile
+}
+
+// Create initialises an empty vault at path encrypted with passphrase. It
+// refuses to overwrite an existing file.
+func Create(path, passphrase string) (*Vault, error) {
+	if passphrase == "" {
+		return nil, fmt.Errorf("passphrase must not be empty")
+	}
+	if _, err := os.Stat(path); err == nil {
+		return nil, fmt.Errorf("vault %s already exists", path)
+	}
+
+	kdf := DefaultKDFParams()
+	kdf.Salt = make([]byte, saltLen)
+	if _, err := rand.Read(kdf.Salt); err != nil {
+		return nil, fmt.Errorf("failed to generate salt: %w", err)
+	}
+
+	v := &Vault{path: path, kdf: kdf, key: deriveKey(passphrase, kdf)}
+	if err := v.Save(); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// Open reads and decrypts the vault at path.
+func Open(path, passphrase string) (*Vault, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read vault: %w", err)
+	}
+
+	var f file
+	if err := json.Unmarshal(raw, &f); err != nil {
+		return nil, fmt.Errorf("failed to parse vault: %w: %w", ErrCorrupt, err)
+	}
+	if f.Version != fileVersion {
+		return nil, fmt.Errorf("unsupported vault version %d", f.Version)
+	}
+	if f.KDF.Name != kdfArgon2id {
+		return nil, fmt.Errorf("unsupported vault KDF %q", f.KDF.Name)
+	}
+	// Argon2 and GCM panic on these rather than returning an error.
+	if f.KDF.Time < 1 || f.KDF.Memory < 1 || f.KDF.Threads < 1 {
+		return nil, fmt.Errorf("%w: invalid KDF parameters", ErrCorrupt)
+	}
+	if len(f.Nonce) != nonceLen {
+		return nil, fmt.Errorf("%w: nonce is %d bytes, want %d", ErrCorrupt, len(f.Nonce), nonceLen)
+	}
+
+	key := deriveKey(passphrase, f.KDF)
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := aead.Open(nil, f.Nonce, f.Ciphertext, additionalData(f))
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+
+	var p payload
+	if err := json.Unmarshal(plaintext, &p); err != nil {
+		return nil, fmt.Errorf("failed to parse vault contents: %w", err)
+	}
+
+	return &Vault{path: path, kdf: f.KDF, key: key, profiles: p.Profiles}, nil
+}
+
+// Profiles returns a copy of every profile in the vault.
+func (v *Vault) Profiles() []models.Profile {
+	return append([]models.Profile(nil), v.profiles...)
+}
+
+// Profile returns the profile with the given name.
+func (v *Vault) Profile(name string) (models.Profile, bool) {
+	for _, p := range v.profiles {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return models.Profile{}, false
+}
+
+// Add stores p, replacing any existing profile with the same name if
+// replace is set.
+func (v *Vault) Add(p models.Profile, replace bool) error {
+	for i, existing := range v.profiles {
+		if existing.Name == p.Name {
+			if !replace {
+				return fmt.Errorf("profile %q already exists", p.Name)
+			}
+			v.profiles[i] = p
+			return nil
+		}
+	}
+	v.profiles = append(v.profiles, p)
+	return nil
+}
+
+// Remove deletes the profile with the given name.
+func (v *Vault) Remove(name string) error {
+	for i, p := range v.profiles {
+		if p.Name == name {
+			v.profiles = append(v.profiles[:i], v.profiles[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("profile %q not found", name)
+}
+
+// Save encrypts the vault with a fresh nonce and atomically replaces the
+// file on disk. The plaintext never touches the filesystem.
+func (v *Vault) Save() error {
+	plaintext, err := json.Marshal(payload{Profiles: v.profiles})
+	if err != nil {
+		return fmt.Errorf("failed to marshal vault contents: %w", err)
+	}
+
+	aead, err := newAEAD(v.key)
+	if err != nil {
+		return err
+	}
+	f := file{Version: fileVersion, KDF: v.kdf, Nonce: make([]byte, aead.NonceSize())}
+	if _, err := rand.Read(f.Nonce); err != nil {
+		return fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	f.Ciphertext = aead.Seal(nil, f.Nonce, plaintext, additionalData(f))
+
+	raw, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal vault: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(v.path), ".vault-*")
+	if err != nil {
+		return fmt.Errorf("failed to write vault: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if err := tmp.Chmod(0o600); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write vault: %w", err)
+	}
+	if _, err := tmp.Write(raw); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write vault: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write vault: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), v.path); err != nil {
+		return fmt.Errorf("failed to write vault: %w", err)
+	}
+	return nil
+}
+
+func deriveKey(passphrase string, kdf KDFParams) []byte {
+	return argon2.IDKey([]byte(passphrase), kdf.Salt, kdf.Time, kdf.Memory, kdf.Threads, keyLen)
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCM: %w", err)
+	}
+	return aead, nil
+}
+
+// additionalData binds the ciphertext to the version and KDF parameters so
+// they cannot be swapped without failing authentication.
+func additionalData(f file) []byte {
+	ad, _ := json.Marshal(struct {
+		Version int       `json:"version"`
+		KDF     KDFParams `json:"kdf"`
+	}{f.Version, f.KDF})
+	return ad
+}
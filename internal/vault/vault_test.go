@@ -0,0 +1,140 @@
+package vault
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"zeng_bot/internal/models"
+)
+
+const passphrase = "correct horse battery staple"
+
+// newVault creates a vault holding one profile and returns its path.
+func newVault(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "vault.json")
+	v, err := Create(path, passphrase)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if err := v.Add(models.Profile{Name: "main", Email: "a@example.com", Password: "hunter2"}, false); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	if err := v.Save(); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	return path
+}
+
+// editVault rewrites the vault file at path through edit.
+func editVault(t *testing.T, path string, edit func(f *file)) {
+	t.Helper()
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var f file
+	if err := json.Unmarshal(raw, &f); err != nil {
+		t.Fatal(err)
+	}
+	edit(&f)
+	if raw, err = json.Marshal(f); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, raw, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOpenRoundTrip(t *testing.T) {
+	path := newVault(t)
+	v, err := Open(path, passphrase)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	p, ok := v.Profile("main")
+	if !ok || p.Email != "a@example.com" || p.Password != "hunter2" {
+		t.Errorf("Profile(main) = %+v, %t", p, ok)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Errorf("vault mode = %o, want 600", perm)
+	}
+}
+
+func TestOpenWrongPassphrase(t *testing.T) {
+	path := newVault(t)
+	if _, err := Open(path, "wrong"); !errors.Is(err, ErrWrongPassphrase) {
+		t.Errorf("Open = %v, want ErrWrongPassphrase", err)
+	}
+}
+
+func TestOpenTampered(t *testing.T) {
+	tests := []struct {
+		name string
+		edit func(f *file)
+	}{
+		{"ciphertext", func(f *file) { f.Ciphertext[0] ^= 1 }},
+		{"KDF parameters", func(f *file) { f.KDF.Time++ }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := newVault(t)
+			editVault(t, path, tt.edit)
+			if _, err := Open(path, passphrase); !errors.Is(err, ErrWrongPassphrase) {
+				t.Errorf("Open = %v, want ErrWrongPassphrase", err)
+			}
+		})
+	}
+}
+
+func TestOpenCorrupt(t *testing.T) {
+	tests := []struct {
+		name string
+		edit func(f *file)
+	}{
+		{"zero threads", func(f *file) { f.KDF.Threads = 0 }},
+		{"zero time", func(f *file) { f.KDF.Time = 0 }},
+		{"zero memory", func(f *file) { f.KDF.Memory = 0 }},
+		{"short nonce", func(f *file) { f.Nonce = f.Nonce[:4] }},
+		{"no nonce", func(f *file) { f.Nonce = nil }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := newVault(t)
+			editVault(t, path, tt.edit)
+			if _, err := Open(path, passphrase); !errors.Is(err, ErrCorrupt) {
+				t.Errorf("Open = %v, want ErrCorrupt", err)
+			}
+		})
+	}
+}
+
+func TestOpenTruncated(t *testing.T) {
+	path := newVault(t)
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range []int{0, len(raw) / 2, len(raw) - 2} {
+		if err := os.WriteFile(path, raw[:n], 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Open(path, passphrase); !errors.Is(err, ErrCorrupt) {
+			t.Errorf("Open of %d of %d bytes = %v, want ErrCorrupt", n, len(raw), err)
+		}
+	}
+}
+
+func TestCreateRefusesExisting(t *testing.T) {
+	path := newVault(t)
+	if _, err := Create(path, passphrase); err == nil {
+		t.Error("Create over an existing vault succeeded")
+	}
+}